@@ -0,0 +1,362 @@
+// Package analysis summarizes a Passage user's recent events into a login risk score.
+//
+// Every point of the score is explained by a Signal, so the result can be logged or shown to support staff as
+// well as used to decide whether to step up authentication, for example from a user login webhook.
+package analysis
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/passageidentity/passage-go/v2"
+)
+
+// SignalKind identifies a risk signal.
+type SignalKind string
+
+const (
+	// SignalDistinctIPs is raised when events within the window come from many IP addresses.
+	SignalDistinctIPs SignalKind = "distinct_ips"
+	// SignalNewUserAgent is raised when the latest event comes from a user agent not seen before.
+	SignalNewUserAgent SignalKind = "new_user_agent"
+	// SignalNewLoginMethod is raised when the latest event uses a social login type or event type not seen before.
+	SignalNewLoginMethod SignalKind = "new_login_method"
+	// SignalIncompleteBurst is raised when many attempts were left incomplete within a short time.
+	SignalIncompleteBurst SignalKind = "incomplete_burst"
+	// SignalUnusualHour is raised when the latest event happens at an hour the user is rarely active.
+	SignalUnusualHour SignalKind = "unusual_hour"
+)
+
+// RiskLevel buckets a risk score.
+type RiskLevel string
+
+const (
+	RiskLow    RiskLevel = "low"
+	RiskMedium RiskLevel = "medium"
+	RiskHigh   RiskLevel = "high"
+)
+
+var defaultWeights = map[SignalKind]float64{
+	SignalDistinctIPs:     25,
+	SignalNewUserAgent:    20,
+	SignalNewLoginMethod:  10,
+	SignalIncompleteBurst: 35,
+	SignalUnusualHour:     15,
+}
+
+const (
+	defaultWindow              = 30 * 24 * time.Hour
+	defaultDistinctIPThreshold = 3
+	defaultBurstWindow         = 10 * time.Minute
+	defaultBurstThreshold      = 3
+	defaultMinHistory          = 5
+	unusualHourShare           = 0.05
+	mediumRiskScore            = 30
+	highRiskScore              = 60
+	maxScore                   = 100
+)
+
+// Options configures Analyze. Zero-valued fields use their defaults.
+type Options struct {
+	// Now is the time the analysis is made at. Defaults to the current time.
+	Now time.Time
+	// Window limits the analysis to events created within this long before Now. Defaults to 30 days.
+	Window time.Duration
+	// Location is the time zone used to determine the hour of events. Defaults to UTC.
+	Location *time.Location
+	// DistinctIPThreshold is the number of distinct IP addresses at which SignalDistinctIPs is raised.
+	// Defaults to 3.
+	DistinctIPThreshold int
+	// BurstWindow and BurstThreshold raise SignalIncompleteBurst when BurstThreshold incomplete events happen
+	// within BurstWindow. They default to 10 minutes and 3.
+	BurstWindow    time.Duration
+	BurstThreshold int
+	// MinHistory is the number of earlier events needed before the latest event is compared with them for new
+	// user agents and new login methods, and of earlier completed events for unusual hours. Defaults to 5.
+	MinHistory int
+	// Weights overrides the score contributed by each kind of signal.
+	Weights map[SignalKind]float64
+}
+
+// Signal is one reason a login is considered risky.
+type Signal struct {
+	Kind SignalKind
+	// Score is the signal's contribution to Report.Score.
+	Score float64
+	// Reason explains the signal in a sentence.
+	Reason string
+	// EventIDs lists the events that raised the signal.
+	EventIDs []string
+}
+
+// Report summarizes a user's recent events.
+type Report struct {
+	// Events is the number of events within the window.
+	Events int
+	// Latest is the most recent event, if there is one.
+	Latest      *passage.UserRecentEvent
+	DistinctIPs []string
+	UserAgents  []string
+	// Incomplete is the number of incomplete events within the window.
+	Incomplete int
+	// Score is the sum of the signal scores, capped at 100.
+	Score   float64
+	Level   RiskLevel
+	Signals []Signal
+}
+
+// Has reports whether the report contains a signal of kind.
+func (r *Report) Has(kind SignalKind) bool {
+	return slices.ContainsFunc(r.Signals, func(signal Signal) bool { return signal.Kind == kind })
+}
+
+// AnalyzeUser analyzes user's recent events.
+func AnalyzeUser(user *passage.PassageUser, opts *Options) *Report {
+	return Analyze(user.RecentEvents, opts)
+}
+
+// AnalyzeLogin analyzes a user login webhook event, treating the login as the latest of the user's events.
+func AnalyzeLogin(event passage.LoginWebhookEvent, opts *Options) *Report {
+	events := slices.Clone(event.User.RecentEvents)
+	if event.Event.ID != "" && !slices.ContainsFunc(events, func(e passage.UserRecentEvent) bool {
+		return e.ID == event.Event.ID
+	}) {
+		events = append(events, event.Event)
+	}
+
+	return Analyze(events, opts)
+}
+
+// Analyze summarizes events into a report. Events may be in any order.
+func Analyze(events []passage.UserRecentEvent, opts *Options) *Report {
+	options := withDefaults(opts)
+
+	inWindow := []passage.UserRecentEvent{}
+	for _, event := range events {
+		if !event.CreatedAt.Before(options.Now.Add(-options.Window)) && !event.CreatedAt.After(options.Now) {
+			inWindow = append(inWindow, event)
+		}
+	}
+	slices.SortStableFunc(inWindow, func(a, b passage.UserRecentEvent) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	report := &Report{
+		Events:      len(inWindow),
+		DistinctIPs: []string{},
+		UserAgents:  []string{},
+		Signals:     []Signal{},
+	}
+
+	for _, event := range inWindow {
+		if event.IPAddr != "" && !slices.Contains(report.DistinctIPs, event.IPAddr) {
+			report.DistinctIPs = append(report.DistinctIPs, event.IPAddr)
+		}
+		if event.UserAgent != "" && !slices.Contains(report.UserAgents, event.UserAgent) {
+			report.UserAgents = append(report.UserAgents, event.UserAgent)
+		}
+		if event.Status == passage.Incomplete {
+			report.Incomplete++
+		}
+	}
+
+	if len(inWindow) > 0 {
+		report.Latest = &inWindow[len(inWindow)-1]
+	}
+
+	a := analyzer{options: options, report: report, events: inWindow}
+	a.distinctIPs()
+	a.incompleteBurst()
+	if len(inWindow) > options.MinHistory {
+		a.newUserAgent()
+		a.newLoginMethod()
+		a.unusualHour()
+	}
+
+	for _, signal := range report.Signals {
+		report.Score += signal.Score
+	}
+	report.Score = min(report.Score, maxScore)
+
+	switch {
+	case report.Score >= highRiskScore:
+		report.Level = RiskHigh
+	case report.Score >= mediumRiskScore:
+		report.Level = RiskMedium
+	default:
+		report.Level = RiskLow
+	}
+
+	return report
+}
+
+func withDefaults(opts *Options) Options {
+	var options Options
+	if opts != nil {
+		options = *opts
+	}
+
+	if options.Now.IsZero() {
+		options.Now = time.Now()
+	}
+	if options.Window <= 0 {
+		options.Window = defaultWindow
+	}
+	if options.Location == nil {
+		options.Location = time.UTC
+	}
+	if options.DistinctIPThreshold <= 0 {
+		options.DistinctIPThreshold = defaultDistinctIPThreshold
+	}
+	if options.BurstWindow <= 0 {
+		options.BurstWindow = defaultBurstWindow
+	}
+	if options.BurstThreshold <= 0 {
+		options.BurstThreshold = defaultBurstThreshold
+	}
+	if options.MinHistory <= 0 {
+		options.MinHistory = defaultMinHistory
+	}
+
+	weights := map[SignalKind]float64{}
+	for kind, weight := range defaultWeights {
+		weights[kind] = weight
+	}
+	for kind, weight := range options.Weights {
+		weights[kind] = weight
+	}
+	options.Weights = weights
+
+	return options
+}
+
+type analyzer struct {
+	options Options
+	report  *Report
+	// events are the events within the window, oldest first.
+	events []passage.UserRecentEvent
+}
+
+func (a *analyzer) raise(kind SignalKind, reason string, events ...passage.UserRecentEvent) {
+	ids := make([]string, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+
+	a.report.Signals = append(a.report.Signals, Signal{
+		Kind:     kind,
+		Score:    a.options.Weights[kind],
+		Reason:   reason,
+		EventIDs: ids,
+	})
+}
+
+func (a *analyzer) history() []passage.UserRecentEvent {
+	return a.events[:len(a.events)-1]
+}
+
+func (a *analyzer) latest() passage.UserRecentEvent {
+	return a.events[len(a.events)-1]
+}
+
+func (a *analyzer) distinctIPs() {
+	ips := a.report.DistinctIPs
+	if len(ips) < a.options.DistinctIPThreshold {
+		return
+	}
+
+	a.raise(
+		SignalDistinctIPs,
+		fmt.Sprintf("events came from %d distinct IP addresses: %s", len(ips), strings.Join(ips, ", ")),
+	)
+}
+
+func (a *analyzer) incompleteBurst() {
+	var incomplete []passage.UserRecentEvent
+	for _, event := range a.events {
+		if event.Status == passage.Incomplete {
+			incomplete = append(incomplete, event)
+		}
+	}
+
+	// find the first run of BurstThreshold incomplete events within BurstWindow
+	threshold := a.options.BurstThreshold
+	for i := 0; i+threshold <= len(incomplete); i++ {
+		burst := incomplete[i : i+threshold]
+		span := burst[len(burst)-1].CreatedAt.Sub(burst[0].CreatedAt)
+		if span <= a.options.BurstWindow {
+			a.raise(
+				SignalIncompleteBurst,
+				fmt.Sprintf("%d attempts were left incomplete within %s", threshold, span.Round(time.Second)),
+				burst...,
+			)
+			return
+		}
+	}
+}
+
+func (a *analyzer) newUserAgent() {
+	latest := a.latest()
+	if latest.UserAgent == "" || slices.ContainsFunc(a.history(), func(event passage.UserRecentEvent) bool {
+		return event.UserAgent == latest.UserAgent
+	}) {
+		return
+	}
+
+	name := latest.UserAgentDisplay
+	if name == "" {
+		name = latest.UserAgent
+	}
+
+	a.raise(SignalNewUserAgent, fmt.Sprintf("latest event came from a new user agent: %s", name), latest)
+}
+
+func loginMethod(event passage.UserRecentEvent) string {
+	if event.SocialLoginType != nil {
+		return string(*event.SocialLoginType)
+	}
+
+	return event.Type
+}
+
+func (a *analyzer) newLoginMethod() {
+	latest := a.latest()
+	method := loginMethod(latest)
+	if method == "" || slices.ContainsFunc(a.history(), func(event passage.UserRecentEvent) bool {
+		return loginMethod(event) == method
+	}) {
+		return
+	}
+
+	a.raise(SignalNewLoginMethod, fmt.Sprintf("latest event used a new login method: %s", method), latest)
+}
+
+func (a *analyzer) unusualHour() {
+	latest := a.latest()
+	hour := latest.CreatedAt.In(a.options.Location).Hour()
+
+	// only completed events show when the user is habitually active
+	completed, same := 0, 0
+	for _, event := range a.history() {
+		if event.Status != passage.Complete {
+			continue
+		}
+
+		completed++
+		if event.CreatedAt.In(a.options.Location).Hour() == hour {
+			same++
+		}
+	}
+
+	if completed < a.options.MinHistory || float64(same)/float64(completed) > unusualHourShare {
+		return
+	}
+
+	a.raise(
+		SignalUnusualHour,
+		fmt.Sprintf("latest event happened at %02d:00, when %d of %d earlier completed events happened", hour, same, completed),
+		latest,
+	)
+}
@@ -0,0 +1,150 @@
+package analysis
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/passageidentity/passage-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// usualEvents returns completed logins made from the same place at midday on consecutive days.
+func usualEvents(n int) []passage.UserRecentEvent {
+	events := []passage.UserRecentEvent{}
+	for i := n; i > 0; i-- {
+		events = append(events, passage.UserRecentEvent{
+			ID:        fmt.Sprintf("usual-%d", i),
+			Action:    passage.UserEventActionLogin,
+			Status:    passage.Complete,
+			Type:      "passkey",
+			IPAddr:    "10.0.0.1",
+			UserAgent: "Safari",
+			CreatedAt: now.AddDate(0, 0, -i),
+		})
+	}
+
+	return events
+}
+
+func TestAnalyzeUsualActivityIsLowRisk(t *testing.T) {
+	events := append(usualEvents(6), passage.UserRecentEvent{
+		ID:        "latest",
+		Status:    passage.Complete,
+		Type:      "passkey",
+		IPAddr:    "10.0.0.1",
+		UserAgent: "Safari",
+		CreatedAt: now,
+	})
+
+	report := Analyze(events, &Options{Now: now})
+
+	assert.Equal(t, 7, report.Events)
+	assert.Empty(t, report.Signals)
+	assert.Equal(t, RiskLow, report.Level)
+	assert.Equal(t, "latest", report.Latest.ID)
+}
+
+func TestAnalyzeSignals(t *testing.T) {
+	google := passage.Google
+	events := usualEvents(6)
+	for i := 0; i < 3; i++ {
+		events = append(events, passage.UserRecentEvent{
+			ID:        fmt.Sprintf("attempt-%d", i),
+			Status:    passage.Incomplete,
+			IPAddr:    fmt.Sprintf("192.0.2.%d", i),
+			CreatedAt: now.Add(-3*time.Hour + time.Duration(i)*time.Minute),
+		})
+	}
+	events = append(events, passage.UserRecentEvent{
+		ID:               "latest",
+		Status:           passage.Complete,
+		Type:             "social",
+		SocialLoginType:  &google,
+		IPAddr:           "192.0.2.9",
+		UserAgent:        "curl/8.0",
+		UserAgentDisplay: "curl",
+		CreatedAt:        now.Add(-3 * time.Hour).Add(10 * time.Minute),
+	})
+
+	report := Analyze(events, &Options{Now: now})
+
+	for _, kind := range []SignalKind{
+		SignalDistinctIPs, SignalIncompleteBurst, SignalNewUserAgent, SignalNewLoginMethod, SignalUnusualHour,
+	} {
+		assert.True(t, report.Has(kind), kind)
+	}
+	assert.Equal(t, float64(maxScore), report.Score)
+	assert.Equal(t, RiskHigh, report.Level)
+	assert.Equal(t, 3, report.Incomplete)
+	assert.Len(t, report.DistinctIPs, 5)
+
+	for _, signal := range report.Signals {
+		assert.NotEmpty(t, signal.Reason)
+		if signal.Kind == SignalIncompleteBurst {
+			assert.Equal(t, []string{"attempt-0", "attempt-1", "attempt-2"}, signal.EventIDs)
+		}
+	}
+}
+
+func TestAnalyzeIgnoresEventsOutsideWindow(t *testing.T) {
+	events := []passage.UserRecentEvent{
+		{ID: "old-1", IPAddr: "192.0.2.1", CreatedAt: now.AddDate(0, -2, 0)},
+		{ID: "old-2", IPAddr: "192.0.2.2", CreatedAt: now.AddDate(0, -2, 0)},
+		{ID: "recent", IPAddr: "192.0.2.3", CreatedAt: now.Add(-time.Hour)},
+	}
+
+	report := Analyze(events, &Options{Now: now})
+
+	assert.Equal(t, 1, report.Events)
+	assert.False(t, report.Has(SignalDistinctIPs))
+}
+
+func TestAnalyzeNeedsHistoryToCompare(t *testing.T) {
+	events := []passage.UserRecentEvent{
+		{ID: "first", UserAgent: "Safari", CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: "second", UserAgent: "Firefox", CreatedAt: now.Add(-time.Hour)},
+	}
+
+	report := Analyze(events, &Options{Now: now})
+
+	assert.False(t, report.Has(SignalNewUserAgent))
+	assert.False(t, report.Has(SignalUnusualHour))
+}
+
+func TestAnalyzeWeights(t *testing.T) {
+	events := usualEvents(3)
+	for i := range events {
+		events[i].IPAddr = fmt.Sprintf("192.0.2.%d", i)
+	}
+
+	report := Analyze(events, &Options{Now: now, Weights: map[SignalKind]float64{SignalDistinctIPs: 70}})
+
+	require.True(t, report.Has(SignalDistinctIPs))
+	assert.Equal(t, float64(70), report.Score)
+	assert.Equal(t, RiskHigh, report.Level)
+}
+
+func TestAnalyzeLoginIncludesTheLogin(t *testing.T) {
+	event := passage.LoginWebhookEvent{
+		User: passage.PassageUser{RecentEvents: usualEvents(6)},
+		Event: passage.UserRecentEvent{
+			ID:        "login",
+			Status:    passage.Complete,
+			Type:      "passkey",
+			IPAddr:    "10.0.0.1",
+			UserAgent: "Chrome",
+			CreatedAt: now,
+		},
+	}
+
+	report := AnalyzeLogin(event, &Options{Now: now})
+
+	assert.Equal(t, 7, report.Events)
+	assert.Equal(t, "login", report.Latest.ID)
+	assert.True(t, report.Has(SignalNewUserAgent))
+	assert.Equal(t, RiskLow, report.Level)
+}
@@ -4,8 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net/http"
 	"slices"
+	"time"
 
 	gojwt "github.com/golang-jwt/jwt/v5"
 	"github.com/lestrrat-go/httprc/v3"
@@ -13,44 +13,89 @@ import (
 )
 
 type MagicLinkOptions struct {
-	Language      MagicLinkLanguage
-	MagicLinkPath string
-	RedirectURL   string
-	TTL           int
+	Language MagicLinkLanguage
+	// AcceptLanguage is a raw Accept-Language header value, such as "pt-BR,pt;q=0.9,en;q=0.8". When set, the
+	// language it prefers most is used, and Language is only used if it has no supported language.
+	AcceptLanguage string
+	MagicLinkPath  string
+	RedirectURL    string
+	// TTL is how long the magic link is valid for, in minutes. The app's default is used when it is 0.
+	TTL int
+	// TTLDuration sets how long the magic link is valid for as a duration instead of TTL. It must be a whole
+	// number of minutes. Only one of TTL and TTLDuration may be set.
+	TTLDuration time.Duration
+}
+
+// ttl returns how long the magic link is valid for, or 0 for the app's default.
+func (opts *MagicLinkOptions) ttl() time.Duration {
+	if opts.TTLDuration != 0 {
+		return opts.TTLDuration
+	}
+
+	return time.Duration(opts.TTL) * time.Minute
 }
 
 type Auth struct {
 	appID        string
 	client       *ClientWithResponses
 	jwksCacheSet jwk.Set
+	revocations  RevocationStore
+	user         *User
+	statusCheck  *userStatusCheck
+	redirects    *redirectAllowList
+	sender       *magicLinkSender
+	dryRun       bool
 }
 
-func newAuth(appID string, client *ClientWithResponses) (*Auth, error) {
+func newAuth(appID string, client *ClientWithResponses, user *User, cfg config) (*Auth, error) {
 	ctx := context.Background()
 
-	rcClient := httprc.NewClient(httprc.WithHTTPClient(http.DefaultClient))
+	rcClient := httprc.NewClient(httprc.WithHTTPClient(newJWKSClient(cfg)))
 
-	url := fmt.Sprintf("https://auth.passage.id/v1/apps/%v/.well-known/jwks.json", appID)
+	url := cfg.jwksURL
+	if url == "" {
+		url = fmt.Sprintf("https://auth.passage.id/v1/apps/%v/.well-known/jwks.json", appID)
+	}
 
 	cache, err := jwk.NewCache(ctx, rcClient)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create JWK cache: %w", err)
 	}
 
-	if err := cache.Register(ctx, url); err != nil {
+	// registering waits for the first fetch, so it is bounded by the JWKS timeout along with the refresh
+	fetchCtx, cancel := context.WithTimeout(ctx, cfg.http.withDefaults().JWKSTimeout)
+	defer cancel()
+
+	if err := cache.Register(fetchCtx, url); err != nil {
 		return nil, fmt.Errorf("failed to register JWKS URL %q in cache: %w", url, err)
 	}
 
-	jwksCacheSet, err := cache.Refresh(ctx, url)
+	jwksCacheSet, err := cache.Refresh(fetchCtx, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch initial JWKS from %q: %w", url, err)
 	}
 
+	return newAuthWithJWKS(appID, client, jwksCacheSet, user, cfg), nil
+}
+
+func newAuthWithJWKS(appID string, client *ClientWithResponses, jwksCacheSet jwk.Set, user *User, cfg config) *Auth {
+	statusCheck := newUserStatusCheck(cfg.userStatusCheck)
+	if user != nil {
+		// the user's operations evict statuses they change, so a deactivated user is rejected immediately
+		user.statusCheck = statusCheck
+	}
+
 	return &Auth{
 		appID:        appID,
 		client:       client,
 		jwksCacheSet: jwksCacheSet,
-	}, nil
+		revocations:  cfg.revocations,
+		user:         user,
+		statusCheck:  statusCheck,
+		redirects:    cfg.redirects,
+		sender:       cfg.sender,
+		dryRun:       cfg.dryRun != nil,
+	}
 }
 
 // CreateMagicLinkWithEmail creates a Magic Link for your app using an email address.
@@ -59,6 +104,7 @@ func (a *Auth) CreateMagicLinkWithEmail(
 	magicLinkType MagicLinkType,
 	send bool,
 	opts *MagicLinkOptions,
+	callOpts ...CallOption,
 ) (*MagicLink, error) {
 	args := magicLinkArgs{
 		Email:       email,
@@ -67,7 +113,7 @@ func (a *Auth) CreateMagicLinkWithEmail(
 		Send:        send,
 	}
 
-	return a.createMagicLink(args, opts)
+	return a.createMagicLink(WithCallOptions(context.Background(), callOpts...), args, opts)
 }
 
 // CreateMagicLinkWithPhone creates a Magic Link for your app using an E164-formatted phone number.
@@ -76,6 +122,7 @@ func (a *Auth) CreateMagicLinkWithPhone(
 	magicLinkType MagicLinkType,
 	send bool,
 	opts *MagicLinkOptions,
+	callOpts ...CallOption,
 ) (*MagicLink, error) {
 	args := magicLinkArgs{
 		Phone:       phone,
@@ -84,7 +131,7 @@ func (a *Auth) CreateMagicLinkWithPhone(
 		Send:        send,
 	}
 
-	return a.createMagicLink(args, opts)
+	return a.createMagicLink(WithCallOptions(context.Background(), callOpts...), args, opts)
 }
 
 // CreateMagicLinkWithUser creates a Magic Link for your app using a Passage user ID.
@@ -94,6 +141,7 @@ func (a *Auth) CreateMagicLinkWithUser(
 	magicLinkType MagicLinkType,
 	send bool,
 	opts *MagicLinkOptions,
+	callOpts ...CallOption,
 ) (*MagicLink, error) {
 	args := magicLinkArgs{
 		UserID:      userID,
@@ -102,7 +150,7 @@ func (a *Auth) CreateMagicLinkWithUser(
 		Send:        send,
 	}
 
-	return a.createMagicLink(args, opts)
+	return a.createMagicLink(WithCallOptions(context.Background(), callOpts...), args, opts)
 }
 
 // ValidateJWT validates the JWT and returns the user ID.
@@ -135,22 +183,40 @@ func (a *Auth) ValidateJWT(jwtTokenStr string) (string, error) {
 		return "", errors.New("failed audience verification for JWT")
 	}
 
+	issuedAt, err := claims.GetIssuedAt()
+	if err != nil {
+		return "", err
+	}
+
+	var iat *time.Time
+	if issuedAt != nil {
+		iat = &issuedAt.Time
+	}
+
+	if err := a.checkRevocation(context.Background(), userID, iat); err != nil {
+		return "", err
+	}
+
 	return userID, nil
 }
 
-func (a *Auth) createMagicLink(args magicLinkArgs, opts *MagicLinkOptions) (*MagicLink, error) {
-	if opts != nil {
-		if err := validateLanguage(opts.Language); err != nil {
-			return nil, err
-		}
+func (a *Auth) createMagicLink(ctx context.Context, args magicLinkArgs, opts *MagicLinkOptions) (*MagicLink, error) {
+	if err := a.checkDryRun(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := a.validateMagicLinkOptions(opts); err != nil {
+		return nil, err
+	}
 
-		args.Language = opts.Language
+	if opts != nil {
+		args.Language = opts.language()
 		args.MagicLinkPath = opts.MagicLinkPath
 		args.RedirectURL = opts.RedirectURL
-		args.TTL = opts.TTL
+		args.TTL = int(opts.ttl() / time.Minute)
 	}
 
-	res, err := a.client.CreateMagicLinkWithResponse(context.Background(), a.appID, args)
+	res, err := a.client.CreateMagicLinkWithResponse(ctx, a.appID, args, requestEditors(ctx)...)
 	if err != nil {
 		return nil, err
 	}
@@ -159,7 +225,47 @@ func (a *Auth) createMagicLink(args magicLinkArgs, opts *MagicLinkOptions) (*Mag
 		return &res.JSON201.MagicLink, nil
 	}
 
-	return nil, errorFromResponse(res.Body, res.StatusCode())
+	return nil, errorFromResponse(res.HTTPResponse, res.Body)
+}
+
+func (a *Auth) validateMagicLinkOptions(opts *MagicLinkOptions) error {
+	if opts == nil {
+		return nil
+	}
+
+	if err := validateLanguage(opts.Language); err != nil {
+		return err
+	}
+
+	if opts.TTL != 0 && opts.TTLDuration != 0 {
+		return errors.New("Only one of TTL or TTLDuration may be set.")
+	}
+
+	if err := validateMagicLinkTTL(opts.ttl()); err != nil {
+		return err
+	}
+
+	return a.checkRedirects(opts)
+}
+
+func (a *Auth) checkRedirects(opts *MagicLinkOptions) error {
+	if a.redirects == nil {
+		return nil
+	}
+
+	if opts.RedirectURL != "" {
+		if err := a.redirects.checkRedirectURL(opts.RedirectURL); err != nil {
+			return err
+		}
+	}
+
+	if opts.MagicLinkPath != "" {
+		if err := a.redirects.checkMagicLinkPath(opts.MagicLinkPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // getPublicKey is the key function for jwt.Parse
@@ -187,11 +293,9 @@ func validateLanguage(language MagicLinkLanguage) error {
 		return nil
 	}
 
-	// Assuming MagicLinkLanguage constants like De, En, Es, etc. are defined elsewhere
-	validLanguages := []MagicLinkLanguage{De, En, Es, It, Pl, Pt, Zh}
-	if slices.Contains(validLanguages, language) {
+	if slices.Contains(supportedMagicLinkLanguages, language) {
 		return nil
 	}
 
-	return fmt.Errorf("language must be one of %v", validLanguages)
+	return fmt.Errorf("language must be one of %v", supportedMagicLinkLanguages)
 }
@@ -0,0 +1,124 @@
+package passage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const defaultUserStatusMaxAge = 30 * time.Second
+
+// statusDeleted is cached for users the API no longer knows about.
+const statusDeleted UserStatus = "deleted"
+
+// ErrUserNotActive is returned by ValidateJWTAndUser when the token is valid but its user is inactive, pending
+// or deleted.
+var ErrUserNotActive = errors.New("user is not active")
+
+// UserStatusCheckOptions configures how ValidateJWTAndUser checks a user's status.
+type UserStatusCheckOptions struct {
+	// MaxAge is how long a user's status is reused before it is fetched again. Defaults to 30 seconds.
+	MaxAge time.Duration
+	// FailOpen accepts tokens whose user status can't be fetched because the Passage API is unreachable or
+	// failing. By default such tokens are rejected.
+	FailOpen bool
+}
+
+// WithUserStatusCheck configures the user status check made by Auth.ValidateJWTAndUser.
+func WithUserStatusCheck(opts UserStatusCheckOptions) Option {
+	return func(cfg *config) error {
+		if opts.MaxAge < 0 {
+			return errors.New("MaxAge must not be negative.")
+		}
+
+		cfg.userStatusCheck = &opts
+		return nil
+	}
+}
+
+type userStatusCheck struct {
+	maxAge   time.Duration
+	failOpen bool
+	statuses *LRUCache
+}
+
+func newUserStatusCheck(opts *UserStatusCheckOptions) *userStatusCheck {
+	check := &userStatusCheck{
+		maxAge:   defaultUserStatusMaxAge,
+		statuses: NewLRUCache(0),
+	}
+
+	if opts != nil {
+		if opts.MaxAge > 0 {
+			check.maxAge = opts.MaxAge
+		}
+		check.failOpen = opts.FailOpen
+	}
+
+	return check
+}
+
+// ValidateJWTAndUser validates the JWT like ValidateJWT and additionally rejects it with ErrUserNotActive if its
+// user has been deactivated, is still pending or has been deleted. User statuses are cached for a short time,
+// configurable with WithUserStatusCheck, so most calls don't make a request to the Passage API. A user changed
+// through the same Passage instance, for example by Activate, Deactivate or Delete, is checked again immediately.
+func (a *Auth) ValidateJWTAndUser(ctx context.Context, jwtTokenStr string) (string, error) {
+	userID, err := a.ValidateJWT(jwtTokenStr)
+	if err != nil {
+		return "", err
+	}
+
+	status, err := a.userStatus(ctx, userID)
+	if err != nil {
+		if a.statusCheck.failOpen && isUnavailableError(err) {
+			return userID, nil
+		}
+
+		return "", fmt.Errorf("failed to check status of user %q: %w", userID, err)
+	}
+
+	if status != StatusActive {
+		return "", fmt.Errorf("%w: user %q is %s", ErrUserNotActive, userID, status)
+	}
+
+	return userID, nil
+}
+
+func (a *Auth) userStatus(ctx context.Context, userID string) (UserStatus, error) {
+	if status, ok, _ := a.statusCheck.statuses.Get(ctx, userID); ok {
+		return UserStatus(status), nil
+	}
+
+	if a.user == nil {
+		return "", errors.New("user status check is not available")
+	}
+
+	// the user cache may be configured with a longer TTL than MaxAge, so it is bypassed
+	user, err := a.user.getUncached(ctx, userID)
+
+	var status UserStatus
+	switch {
+	case err == nil:
+		status = user.Status
+	case isNotFoundError(err):
+		status = statusDeleted
+	default:
+		return "", err
+	}
+
+	_ = a.statusCheck.statuses.Set(ctx, userID, []byte(status), a.statusCheck.maxAge)
+	return status, nil
+}
+
+// isUnavailableError reports whether err means the Passage API could not serve the request, as opposed to the
+// request being rejected.
+func isUnavailableError(err error) bool {
+	var passageErr PassageError
+	if !errors.As(err, &passageErr) {
+		return true
+	}
+
+	return passageErr.StatusCode >= http.StatusInternalServerError || passageErr.StatusCode == http.StatusTooManyRequests
+}
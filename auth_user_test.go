@@ -0,0 +1,145 @@
+package passage
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateJWTAndUserChecksStatus(t *testing.T) {
+	api := newFakeAPI(t,
+		PassageUser{ID: "active", Status: StatusActive},
+		PassageUser{ID: "inactive", Status: StatusInactive},
+		PassageUser{ID: "pending", Status: StatusPending},
+	)
+	auth, signer := newTestAuth(t)
+	auth.user = newTestUser(t, api)
+	ctx := context.Background()
+
+	userID, err := auth.ValidateJWTAndUser(ctx, signer.sign("active", time.Now()))
+	require.NoError(t, err)
+	assert.Equal(t, "active", userID)
+
+	for _, userID := range []string{"inactive", "pending", "deleted"} {
+		_, err := auth.ValidateJWTAndUser(ctx, signer.sign(userID, time.Now()))
+		assert.ErrorIs(t, err, ErrUserNotActive, userID)
+	}
+
+	// statuses are reused until they are older than MaxAge
+	_, err = auth.ValidateJWTAndUser(ctx, signer.sign("active", time.Now()))
+	require.NoError(t, err)
+	assert.Equal(t, 4, api.count("get"))
+}
+
+func TestValidateJWTAndUserRefreshesStatusAfterMaxAge(t *testing.T) {
+	api := newFakeAPI(t, PassageUser{ID: "user-1", Status: StatusActive})
+	auth, signer := newTestAuth(t, WithUserStatusCheck(UserStatusCheckOptions{MaxAge: time.Minute}))
+	auth.user = newTestUser(t, api)
+
+	now := time.Now()
+	auth.statusCheck.statuses.now = func() time.Time { return now }
+
+	_, err := auth.ValidateJWTAndUser(context.Background(), signer.sign("user-1", time.Now()))
+	require.NoError(t, err)
+
+	// a User not sharing the Auth's status check stands in for another process deactivating the user
+	_, err = auth.user.Deactivate("user-1")
+	require.NoError(t, err)
+
+	_, err = auth.ValidateJWTAndUser(context.Background(), signer.sign("user-1", time.Now()))
+	assert.NoError(t, err)
+
+	now = now.Add(2 * time.Minute)
+	_, err = auth.ValidateJWTAndUser(context.Background(), signer.sign("user-1", time.Now()))
+	assert.ErrorIs(t, err, ErrUserNotActive)
+}
+
+func TestValidateJWTAndUserRejectsUserDeactivatedByTheSameInstance(t *testing.T) {
+	api := newFakeAPI(t, PassageUser{ID: "user-1", Status: StatusActive}, PassageUser{ID: "user-2", Status: StatusActive})
+	signed, signer := newTestAuth(t)
+	user := newTestUser(t, api)
+	auth := newAuthWithJWKS(testAppID, nil, signed.jwksCacheSet, user, config{})
+	ctx := context.Background()
+
+	for _, userID := range []string{"user-1", "user-2"} {
+		_, err := auth.ValidateJWTAndUser(ctx, signer.sign(userID, time.Now()))
+		require.NoError(t, err)
+	}
+
+	_, err := user.Deactivate("user-1")
+	require.NoError(t, err)
+	require.NoError(t, user.Delete("user-2"))
+
+	for _, userID := range []string{"user-1", "user-2"} {
+		_, err = auth.ValidateJWTAndUser(ctx, signer.sign(userID, time.Now()))
+		assert.ErrorIs(t, err, ErrUserNotActive, userID)
+	}
+}
+
+func TestValidateJWTAndUserAcceptsUserActivatedByTheSameInstance(t *testing.T) {
+	api := newFakeAPI(t, PassageUser{ID: "user-1", Status: StatusInactive}, PassageUser{ID: "user-2", Status: StatusInactive})
+	signed, signer := newTestAuth(t)
+	user := newTestUser(t, api)
+	auth := newAuthWithJWKS(testAppID, nil, signed.jwksCacheSet, user, config{})
+	ctx := context.Background()
+
+	for _, userID := range []string{"user-1", "user-2"} {
+		_, err := auth.ValidateJWTAndUser(ctx, signer.sign(userID, time.Now()))
+		require.ErrorIs(t, err, ErrUserNotActive)
+	}
+
+	_, err := user.Activate("user-1")
+	require.NoError(t, err)
+
+	_, err = auth.ValidateJWTAndUser(ctx, signer.sign("user-1", time.Now()))
+	assert.NoError(t, err)
+
+	// the status of a user who wasn't changed stays cached
+	_, err = auth.ValidateJWTAndUser(ctx, signer.sign("user-2", time.Now()))
+	assert.ErrorIs(t, err, ErrUserNotActive)
+	assert.Equal(t, 3, api.count("get"))
+}
+
+func TestValidateJWTAndUserWhenAPIIsUnavailable(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, http.StatusServiceUnavailable, map[string]string{"code": "unavailable", "error": "unavailable"})
+	})
+
+	tests := []struct {
+		name     string
+		failOpen bool
+	}{
+		{name: "fail closed", failOpen: false},
+		{name: "fail open", failOpen: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, signer := newTestAuth(t, WithUserStatusCheck(UserStatusCheckOptions{FailOpen: tt.failOpen}))
+			auth.user = newTestUser(t, handler)
+
+			userID, err := auth.ValidateJWTAndUser(context.Background(), signer.sign("user-1", time.Now()))
+			if tt.failOpen {
+				require.NoError(t, err)
+				assert.Equal(t, "user-1", userID)
+			} else {
+				assert.Error(t, err)
+				assert.NotErrorIs(t, err, ErrUserNotActive)
+			}
+		})
+	}
+}
+
+func TestValidateJWTAndUserRejectsInvalidTokens(t *testing.T) {
+	api := newFakeAPI(t)
+	auth, _ := newTestAuth(t, WithUserStatusCheck(UserStatusCheckOptions{FailOpen: true}))
+	auth.user = newTestUser(t, api)
+
+	_, err := auth.ValidateJWTAndUser(context.Background(), "not-a-jwt")
+	assert.Error(t, err)
+	assert.Equal(t, 0, api.count("get"))
+}
@@ -0,0 +1,109 @@
+package passage
+
+import (
+	"context"
+	"sync"
+)
+
+const defaultBulkConcurrency = 10
+
+// BulkOptions configures operations that act on many users at once.
+type BulkOptions struct {
+	// Concurrency is the maximum number of requests in flight at once. Defaults to 10.
+	Concurrency int
+	// RateLimit is the maximum number of requests started per second. Requests are not rate limited when it is 0.
+	RateLimit float64
+	// DryRun reports which users would be affected without changing anything.
+	DryRun bool
+}
+
+// BulkReport is the outcome of an operation on many users.
+type BulkReport struct {
+	DryRun bool
+	// Matched lists the IDs of every user the operation applied to.
+	Matched []string
+	// Succeeded lists the IDs of the users the operation succeeded for. It is empty for a dry run.
+	Succeeded []string
+	// Failed holds the error for every user the operation failed for.
+	Failed map[string]error
+}
+
+// runBulk calls fn for every ID with bounded concurrency and rate limiting. It stops starting new calls once ctx
+// is done and records the context error for the IDs that were never attempted.
+func runBulk(ctx context.Context, ids []string, opts *BulkOptions, fn func(ctx context.Context, id string) error) *BulkReport {
+	var options BulkOptions
+	if opts != nil {
+		options = *opts
+	}
+
+	report := &BulkReport{
+		DryRun:    options.DryRun,
+		Matched:   ids,
+		Succeeded: []string{},
+		Failed:    map[string]error{},
+	}
+
+	if options.DryRun {
+		return report
+	}
+
+	var mu sync.Mutex
+	forEachBulk(ctx, len(ids), options, func(ctx context.Context, i int) error {
+		return fn(ctx, ids[i])
+	}, func(i int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err != nil {
+			report.Failed[ids[i]] = err
+		} else {
+			report.Succeeded = append(report.Succeeded, ids[i])
+		}
+	})
+
+	return report
+}
+
+// forEachBulk calls fn for the indexes 0 to n-1 with the concurrency and rate limit of opts, and passes the result
+// of each call to done, which may be called concurrently. It stops starting new calls once ctx is done and passes
+// the context error to done for the indexes that were never attempted.
+func forEachBulk(ctx context.Context, n int, opts BulkOptions, fn func(ctx context.Context, i int) error, done func(i int, err error)) {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBulkConcurrency
+	}
+
+	var limiter *tokenBucket
+	if opts.RateLimit > 0 {
+		limiter = newTokenBucket(opts.RateLimit, 1)
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+
+	for i := range n {
+		if limiter != nil {
+			if _, err := limiter.wait(ctx); err != nil {
+				done(i, err)
+				continue
+			}
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			done(i, ctx.Err())
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			done(i, fn(ctx, i))
+		}()
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,216 @@
+package passage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const defaultLRUCacheCapacity = 1000
+
+// ErrCacheMiss is returned by RedisClient.Get when the key does not exist.
+var ErrCacheMiss = errors.New("cache miss")
+
+// Cache is a key-value store with per-entry expiry. Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the value stored for key and whether it was found.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value for key until ttl has elapsed.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Add stores value for key until ttl has elapsed, only if key has no unexpired value. It reports whether value
+	// was stored. Checking and storing must happen atomically.
+	Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// Delete removes keys. Missing keys are not an error.
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// LRUCache is an in-memory Cache that evicts the least recently used entry once it is full.
+type LRUCache struct {
+	capacity int
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewLRUCache creates an LRUCache holding at most capacity entries. A capacity of 0 or less defaults to 1000.
+func NewLRUCache(capacity int) *LRUCache {
+	if capacity <= 0 {
+		capacity = defaultLRUCacheCapacity
+	}
+
+	return &LRUCache{
+		capacity: capacity,
+		now:      time.Now,
+		entries:  map[string]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+// Get implements Cache.
+func (c *LRUCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry := element.Value.(*lruEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.remove(element)
+		return nil, false, nil
+	}
+
+	c.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+// Set implements Cache.
+func (c *LRUCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := c.now().Add(ttl)
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+
+	return nil
+}
+
+// Add implements Cache.
+func (c *LRUCache) Add(_ context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		if c.now().Before(element.Value.(*lruEntry).expiresAt) {
+			return false, nil
+		}
+		c.remove(element)
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expiresAt: c.now().Add(ttl)})
+
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+
+	return true, nil
+}
+
+// Delete implements Cache.
+func (c *LRUCache) Delete(_ context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if element, ok := c.entries[key]; ok {
+			c.remove(element)
+		}
+	}
+
+	return nil
+}
+
+// Len returns the number of entries in the cache, including expired entries that have not been evicted yet.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *LRUCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*lruEntry).key)
+}
+
+// RedisClient is the subset of Redis commands used by RedisCache. It is small enough to be satisfied by a thin
+// adapter around any Redis client library.
+type RedisClient interface {
+	// Get returns the value of key, or ErrCacheMiss if it does not exist.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores value at key with an expiry of ttl, like SET key value PX ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// SetNX stores value at key with an expiry of ttl only if key does not exist, like SET key value NX PX ttl. It
+	// reports whether value was stored.
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// Del removes keys.
+	Del(ctx context.Context, keys ...string) error
+}
+
+// RedisCache is a Cache backed by Redis or any store speaking the RedisClient interface, so entries
+// are shared between processes.
+type RedisCache struct {
+	client    RedisClient
+	keyPrefix string
+}
+
+// NewRedisCache creates a RedisCache that namespaces every key with keyPrefix.
+func NewRedisCache(client RedisClient, keyPrefix string) *RedisCache {
+	return &RedisCache{
+		client:    client,
+		keyPrefix: keyPrefix,
+	}
+}
+
+// Get implements Cache.
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.client.Get(ctx, c.keyPrefix+key)
+	if errors.Is(err, ErrCacheMiss) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+// Set implements Cache.
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, c.keyPrefix+key, value, ttl)
+}
+
+// Add implements Cache.
+func (c *RedisCache) Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return c.client.SetNX(ctx, c.keyPrefix+key, value, ttl)
+}
+
+// Delete implements Cache.
+func (c *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.keyPrefix + key
+	}
+
+	return c.client.Del(ctx, prefixed...)
+}
@@ -0,0 +1,143 @@
+package passage
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRUCache(2)
+
+	require.NoError(t, cache.Set(ctx, "a", []byte("1"), time.Minute))
+	require.NoError(t, cache.Set(ctx, "b", []byte("2"), time.Minute))
+
+	_, ok, _ := cache.Get(ctx, "a")
+	require.True(t, ok)
+
+	require.NoError(t, cache.Set(ctx, "c", []byte("3"), time.Minute))
+
+	_, ok, _ = cache.Get(ctx, "b")
+	assert.False(t, ok)
+
+	value, ok, _ := cache.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestLRUCacheExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	cache := NewLRUCache(10)
+	cache.now = func() time.Time { return now }
+
+	require.NoError(t, cache.Set(ctx, "a", []byte("1"), time.Minute))
+
+	now = now.Add(59 * time.Second)
+	_, ok, _ := cache.Get(ctx, "a")
+	assert.True(t, ok)
+
+	now = now.Add(time.Second)
+	_, ok, _ = cache.Get(ctx, "a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, cache.Len())
+}
+
+// fakeRedis implements RedisClient with a map and ignores expiry.
+type fakeRedis struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{values: map[string][]byte{}}
+}
+
+func (r *fakeRedis) Get(_ context.Context, key string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	value, ok := r.values[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	return value, nil
+}
+
+func (r *fakeRedis) Set(_ context.Context, key string, value []byte, _ time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.values[key] = value
+	return nil
+}
+
+func (r *fakeRedis) SetNX(_ context.Context, key string, value []byte, _ time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.values[key]; ok {
+		return false, nil
+	}
+	r.values[key] = value
+	return true, nil
+}
+
+func (r *fakeRedis) Del(_ context.Context, keys ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range keys {
+		delete(r.values, key)
+	}
+	return nil
+}
+
+func TestRedisCachePrefixesKeys(t *testing.T) {
+	ctx := context.Background()
+	redis := newFakeRedis()
+	cache := NewRedisCache(redis, "svc:")
+
+	require.NoError(t, cache.Set(ctx, "a", []byte("1"), time.Minute))
+	assert.Contains(t, redis.values, "svc:a")
+
+	value, ok, err := cache.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+
+	require.NoError(t, cache.Delete(ctx, "a"))
+	_, ok, err = cache.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestLRUCacheAdd(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	cache := NewLRUCache(2)
+	cache.now = func() time.Time { return now }
+
+	added, err := cache.Add(ctx, "a", []byte("1"), time.Second)
+	require.NoError(t, err)
+	assert.True(t, added)
+
+	added, err = cache.Add(ctx, "a", []byte("2"), time.Second)
+	require.NoError(t, err)
+	assert.False(t, added)
+
+	value, _, _ := cache.Get(ctx, "a")
+	assert.Equal(t, []byte("1"), value)
+
+	// an expired entry can be replaced
+	now = now.Add(time.Second)
+	added, err = cache.Add(ctx, "a", []byte("3"), time.Second)
+	require.NoError(t, err)
+	assert.True(t, added)
+}
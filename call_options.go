@@ -0,0 +1,187 @@
+package passage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// idempotencyKeyHeader is the request header CallIdempotencyKey sets.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// requestIDHeaders are the response headers the Passage API may identify a request with.
+var requestIDHeaders = []string{"X-Request-Id", "Request-Id"}
+
+func requestIDOf(header http.Header) string {
+	for _, name := range requestIDHeaders {
+		if id := header.Get(name); id != "" {
+			return id
+		}
+	}
+
+	return ""
+}
+
+// CallOption configures a single call to a User or Auth method.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	capture        *responseCapture
+	header         http.Header
+	timeout        time.Duration
+	idempotencyKey string
+	retry          *RetryOptions
+	editors        []RequestEditorFn
+	dryRun         *dryRunCapture
+}
+
+// CallHeader sets a header on the requests made by the call. It can't replace the Authorization header.
+func CallHeader(key, value string) CallOption {
+	return func(opts *callOptions) {
+		opts.header = opts.header.Clone()
+		if opts.header == nil {
+			opts.header = http.Header{}
+		}
+		opts.header.Set(key, value)
+	}
+}
+
+// CallTimeout limits how long each request made by the call takes, including any retries. HTTPOptions.Timeout
+// still limits each attempt.
+func CallTimeout(timeout time.Duration) CallOption {
+	return func(opts *callOptions) {
+		opts.timeout = timeout
+	}
+}
+
+// CallIdempotencyKey sends key as the Idempotency-Key header of the call's requests. The SDK doesn't rely on the
+// Passage API honoring it: requests with a non-idempotent method are never retried, with or without a key.
+func CallIdempotencyKey(key string) CallOption {
+	return func(opts *callOptions) {
+		opts.idempotencyKey = key
+	}
+}
+
+// CallRetry overrides the retry behavior configured with WithRetry for the call. RetryOptions{MaxAttempts: 1}
+// disables retries.
+func CallRetry(retry RetryOptions) CallOption {
+	return func(opts *callOptions) {
+		opts.retry = &retry
+	}
+}
+
+// CallRequestEditor edits the requests made by the call before they are sent.
+func CallRequestEditor(editor RequestEditorFn) CallOption {
+	return func(opts *callOptions) {
+		opts.editors = append(slices.Clip(opts.editors), editor)
+	}
+}
+
+// changeRequests reports whether opts change the requests a call makes or how they are made, so the call can't
+// share its requests with other calls.
+func (opts callOptions) changeRequests() bool {
+	return opts.header != nil || opts.timeout > 0 || opts.idempotencyKey != "" || opts.retry != nil ||
+		len(opts.editors) > 0
+}
+
+type callOptionsKey struct{}
+
+// WithCallOptions returns a context that applies opts to the calls made with it. It is how CallOptions are given to
+// methods that take a context.
+func WithCallOptions(ctx context.Context, opts ...CallOption) context.Context {
+	if len(opts) == 0 {
+		return ctx
+	}
+
+	options := callOptionsFrom(ctx)
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return context.WithValue(ctx, callOptionsKey{}, options)
+}
+
+func callOptionsFrom(ctx context.Context) callOptions {
+	options, _ := ctx.Value(callOptionsKey{}).(callOptions)
+	return options
+}
+
+// requestEditors returns the request editors that apply the call options of ctx, to be given to the generated
+// client.
+func requestEditors(ctx context.Context) []RequestEditorFn {
+	options := callOptionsFrom(ctx)
+	if options.header == nil && options.idempotencyKey == "" && len(options.editors) == 0 {
+		return nil
+	}
+
+	editors := []RequestEditorFn{func(_ context.Context, req *http.Request) error {
+		for key, values := range options.header {
+			req.Header[key] = slices.Clone(values)
+		}
+
+		if options.idempotencyKey != "" {
+			req.Header.Set(idempotencyKeyHeader, options.idempotencyKey)
+		}
+
+		return nil
+	}}
+
+	return append(editors, options.editors...)
+}
+
+// Response is a raw response from the Passage API.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// RequestID identifies the request to Passage support.
+	RequestID string
+}
+
+type responseCapture struct {
+	mu  sync.Mutex
+	dst *Response
+}
+
+// CaptureResponse stores the raw response to the call in dst. For calls that make several requests, it is the
+// response to the last one. dst is left unchanged if the call made no request itself, for example because it was
+// served from the user cache or shared a concurrent call's request.
+func CaptureResponse(dst *Response) CallOption {
+	return func(opts *callOptions) {
+		opts.capture = &responseCapture{dst: dst}
+	}
+}
+
+// withResponseCapture stores responses in the Response given with CaptureResponse, if any.
+func withResponseCapture(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		capture := callOptionsFrom(req.Context()).capture
+
+		res, err := next.RoundTrip(req)
+		if err != nil || capture == nil {
+			return res, err
+		}
+
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		res.Body = io.NopCloser(bytes.NewReader(body))
+
+		capture.mu.Lock()
+		*capture.dst = Response{
+			StatusCode: res.StatusCode,
+			Header:     res.Header.Clone(),
+			Body:       body,
+			RequestID:  requestIDOf(res.Header),
+		}
+		capture.mu.Unlock()
+
+		return res, nil
+	})
+}
@@ -0,0 +1,122 @@
+package passage
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withRequestID serves handler, setting a request ID header on every response.
+func withRequestID(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req-123")
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func TestCaptureResponse(t *testing.T) {
+	u := newTestUser(t, withRequestID(newFakeAPI(t, PassageUser{ID: "user-1", Email: "a@example.com"})))
+
+	var res Response
+	user, err := u.Get("user-1", CaptureResponse(&res))
+	require.NoError(t, err)
+	assert.Equal(t, "a@example.com", user.Email)
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "req-123", res.RequestID)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	assert.Contains(t, string(res.Body), `"email":"a@example.com"`)
+}
+
+func TestCaptureResponseOfFailedCall(t *testing.T) {
+	u := newTestUser(t, withRequestID(newFakeAPI(t)))
+
+	var res Response
+	err := u.Delete("missing", CaptureResponse(&res))
+
+	var passageErr PassageError
+	require.ErrorAs(t, err, &passageErr)
+	assert.Equal(t, "req-123", passageErr.RequestID)
+	assert.Contains(t, passageErr.Error(), "requestID: req-123")
+
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	assert.Contains(t, string(res.Body), "user not found")
+}
+
+func TestUnknownIdentifierErrorHasRequestID(t *testing.T) {
+	u := newTestUser(t, withRequestID(newFakeAPI(t)))
+
+	_, err := u.GetByIdentifier("missing@example.com")
+
+	var passageErr PassageError
+	require.ErrorAs(t, err, &passageErr)
+	assert.Equal(t, http.StatusNotFound, passageErr.StatusCode)
+	assert.Equal(t, "req-123", passageErr.RequestID)
+}
+
+func TestWithCallOptionsForContextMethods(t *testing.T) {
+	u := newTestUser(t, withRequestID(newFakeAPI(t, PassageUser{ID: "user-1"})))
+
+	var res Response
+	ctx := WithCallOptions(context.Background(), CaptureResponse(&res))
+	_, _, err := GetTyped[map[string]any](ctx, u, "user-1")
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "req-123", res.RequestID)
+}
+
+func TestCallsWithoutCaptureAreUnaffected(t *testing.T) {
+	u := newTestUser(t, withRequestID(newFakeAPI(t, PassageUser{ID: "user-1"})))
+
+	_, err := u.Get("user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, context.Background(), WithCallOptions(context.Background()))
+}
+
+func TestCallOptionsEditRequests(t *testing.T) {
+	api := newFakeAPI(t)
+	var header http.Header
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		api.ServeHTTP(w, r)
+	}))
+
+	_, err := u.Create(CreateUserArgs{Email: "a@example.com"},
+		CallHeader("X-Trace", "trace-1"),
+		CallIdempotencyKey("key-1"),
+		CallRequestEditor(func(_ context.Context, req *http.Request) error {
+			req.Header.Set("X-Edited", "yes")
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, "trace-1", header.Get("X-Trace"))
+	assert.Equal(t, "key-1", header.Get("Idempotency-Key"))
+	assert.Equal(t, "yes", header.Get("X-Edited"))
+}
+
+func TestCallHeaderDoesNotLeakIntoParentContext(t *testing.T) {
+	parent := WithCallOptions(context.Background(), CallHeader("X-A", "a"))
+	child := WithCallOptions(parent, CallHeader("X-B", "b"))
+
+	assert.Equal(t, http.Header{"X-A": {"a"}}, callOptionsFrom(parent).header)
+	assert.Equal(t, http.Header{"X-A": {"a"}, "X-B": {"b"}}, callOptionsFrom(child).header)
+}
+
+func TestCallTimeout(t *testing.T) {
+	wait := hang(t)
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wait(r)
+	}))
+
+	start := time.Now()
+	_, err := u.Get("user-1", CallTimeout(50*time.Millisecond))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,290 @@
+package passage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultCredentialsPollInterval = 10 * time.Second
+
+// Credentials are the Passage API keys requests are authenticated with.
+type Credentials struct {
+	APIKey string
+	// SecondaryAPIKey, when set, is tried when the Passage API rejects APIKey with a 401, for example while a key
+	// is being rotated. Once it was accepted instead, it is tried first for the next 5 minutes.
+	SecondaryAPIKey string
+}
+
+// CredentialsProvider provides the credentials for each request, so API keys can be rotated without restarting.
+// Implementations must be safe for concurrent use and should be fast, since they are called for every request.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// CredentialsFunc adapts a function to a CredentialsProvider, for example to read keys from a secrets manager.
+type CredentialsFunc func(ctx context.Context) (Credentials, error)
+
+// Credentials implements CredentialsProvider.
+func (f CredentialsFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// StaticCredentials returns a CredentialsProvider that always provides the given keys.
+func StaticCredentials(apiKey string, secondaryAPIKey string) CredentialsProvider {
+	return CredentialsFunc(func(context.Context) (Credentials, error) {
+		return Credentials{APIKey: apiKey, SecondaryAPIKey: secondaryAPIKey}, nil
+	})
+}
+
+// EnvCredentials is a CredentialsProvider that reads API keys from environment variables on every request.
+type EnvCredentials struct {
+	// Name is the variable holding the API key.
+	Name string
+	// SecondaryName, when set, is the variable holding the secondary API key.
+	SecondaryName string
+}
+
+// Credentials implements CredentialsProvider.
+func (e EnvCredentials) Credentials(context.Context) (Credentials, error) {
+	apiKey := os.Getenv(e.Name)
+	if apiKey == "" {
+		return Credentials{}, fmt.Errorf("environment variable %s is not set", e.Name)
+	}
+
+	creds := Credentials{APIKey: apiKey}
+	if e.SecondaryName != "" {
+		creds.SecondaryAPIKey = os.Getenv(e.SecondaryName)
+	}
+
+	return creds, nil
+}
+
+// FileCredentialsOptions configures NewFileCredentials.
+type FileCredentialsOptions struct {
+	// SecondaryPath, when set, is the file holding the secondary API key.
+	SecondaryPath string
+	// PollInterval is how often the files are checked for changes. Defaults to 10 seconds.
+	PollInterval time.Duration
+}
+
+// FileCredentials is a CredentialsProvider that reads API keys from files, such as mounted secrets, and reloads
+// them when they change.
+type FileCredentials struct {
+	path          string
+	secondaryPath string
+	pollInterval  time.Duration
+	now           func() time.Time
+
+	mu        sync.Mutex
+	creds     Credentials
+	versions  [2]fileVersion
+	lastCheck time.Time
+}
+
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewFileCredentials creates a FileCredentials reading the API key from path. The files must exist.
+func NewFileCredentials(path string, opts *FileCredentialsOptions) (*FileCredentials, error) {
+	if path == "" {
+		return nil, errors.New("path is required.")
+	}
+
+	f := &FileCredentials{
+		path:         path,
+		pollInterval: defaultCredentialsPollInterval,
+		now:          time.Now,
+	}
+
+	if opts != nil {
+		f.secondaryPath = opts.SecondaryPath
+		if opts.PollInterval > 0 {
+			f.pollInterval = opts.PollInterval
+		}
+	}
+
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	f.lastCheck = f.now()
+
+	return f, nil
+}
+
+// Credentials implements CredentialsProvider. If a changed file can't be read, the last keys read are kept.
+func (f *FileCredentials) Credentials(context.Context) (Credentials, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if now := f.now(); now.Sub(f.lastCheck) >= f.pollInterval {
+		f.lastCheck = now
+		_ = f.reload()
+	}
+
+	return f.creds, nil
+}
+
+// reload reads the files if they changed since they were last read. f.mu must be held, except while constructing.
+func (f *FileCredentials) reload() error {
+	primary, primaryVersion, err := readKeyFile(f.path, f.versions[0])
+	if err != nil {
+		return err
+	}
+
+	var secondary []byte
+	secondaryVersion := f.versions[1]
+	if f.secondaryPath != "" {
+		secondary, secondaryVersion, err = readKeyFile(f.secondaryPath, f.versions[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	if primary != nil {
+		f.creds.APIKey = string(primary)
+	}
+	if secondary != nil {
+		f.creds.SecondaryAPIKey = string(secondary)
+	}
+	f.versions = [2]fileVersion{primaryVersion, secondaryVersion}
+	return nil
+}
+
+// readKeyFile returns the key in path, or nil if the file hasn't changed since version.
+func readKeyFile(path string, version fileVersion) ([]byte, fileVersion, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, version, err
+	}
+
+	current := fileVersion{modTime: info.ModTime(), size: info.Size()}
+	if current == version {
+		return nil, version, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, version, err
+	}
+
+	key := bytes.TrimSpace(data)
+	if len(key) == 0 {
+		return nil, version, fmt.Errorf("%s is empty", path)
+	}
+
+	return key, current, nil
+}
+
+// WithCredentialsProvider authenticates every request with the credentials provider gives at the time, instead
+// of the API key passed to New, which may then be empty.
+func WithCredentialsProvider(provider CredentialsProvider) Option {
+	return func(cfg *config) error {
+		if provider == nil {
+			return errors.New("provider is required.")
+		}
+
+		cfg.credentials = provider
+		return nil
+	}
+}
+
+// withCredentials sets the Authorization header of every request, retrying once with the secondary API key if the
+// primary one is rejected. Once the secondary key was accepted instead, it is tried first for the fallback period,
+// so a revoked primary key doesn't make every request twice.
+func withCredentials(next http.RoundTripper, provider CredentialsProvider) http.RoundTripper {
+	fallback := &credentialsFallback{period: credentialsFallbackPeriod, now: time.Now}
+
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		creds, err := provider.Credentials(req.Context())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Passage credentials: %w", err)
+		}
+
+		first, second := creds.APIKey, creds.SecondaryAPIKey
+		if second == first {
+			second = ""
+		}
+
+		secondaryFirst := second != "" && fallback.active(creds.APIKey)
+		if secondaryFirst {
+			first, second = second, first
+		}
+
+		res, err := next.RoundTrip(authorize(req, first))
+		if err != nil || res.StatusCode != http.StatusUnauthorized || second == "" {
+			return res, err
+		}
+
+		retry := authorize(req, second)
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return res, nil
+			}
+
+			body, err := req.GetBody()
+			if err != nil {
+				return res, nil
+			}
+			retry.Body = body
+		}
+
+		res.Body.Close()
+		res, err = next.RoundTrip(retry)
+		if err == nil && res.StatusCode != http.StatusUnauthorized {
+			fallback.set(creds.APIKey, !secondaryFirst)
+		}
+
+		return res, err
+	})
+}
+
+// credentialsFallbackPeriod is how long the secondary API key is tried first after the primary one was rejected.
+const credentialsFallbackPeriod = 5 * time.Minute
+
+// credentialsFallback remembers which primary API key was rejected while the secondary one was accepted.
+type credentialsFallback struct {
+	period time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex
+	rejected string
+	until    time.Time
+}
+
+// active reports whether the secondary API key should be tried before apiKey.
+func (f *credentialsFallback) active(apiKey string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.rejected == apiKey && f.now().Before(f.until)
+}
+
+// set starts the fallback period for the rejected primary apiKey, or ends it if the primary key was accepted.
+func (f *credentialsFallback) set(apiKey string, rejected bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if rejected {
+		f.rejected, f.until = apiKey, f.now().Add(f.period)
+	} else {
+		f.rejected, f.until = "", time.Time{}
+	}
+}
+
+func authorize(req *http.Request, apiKey string) *http.Request {
+	authorized := req.Clone(req.Context())
+	if apiKey != "" {
+		authorized.Header.Set("Authorization", "Bearer "+strings.TrimSpace(apiKey))
+	}
+
+	return authorized
+}
@@ -0,0 +1,195 @@
+package passage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keyCheckingAPI serves api to requests authenticated with the accepted key and responds 401 to others, recording
+// the keys it sees.
+type keyCheckingAPI struct {
+	api *fakeAPI
+
+	mu       sync.Mutex
+	accepted string
+	seen     []string
+}
+
+func (k *keyCheckingAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	k.mu.Lock()
+	k.seen = append(k.seen, key)
+	accepted := k.accepted
+	k.mu.Unlock()
+
+	if key != accepted {
+		writeJSON(k.api.t, w, http.StatusUnauthorized, N401Error{Code: "invalid_access_token", Error: "unauthorized"})
+		return
+	}
+	k.api.ServeHTTP(w, r)
+}
+
+func (k *keyCheckingAPI) keys() []string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	keys := k.seen
+	k.seen = nil
+	return keys
+}
+
+func TestCredentialsFallBackToSecondaryKey(t *testing.T) {
+	api := &keyCheckingAPI{api: newFakeAPI(t, PassageUser{ID: "user-1"}), accepted: "new-key"}
+	u := newTestUser(t, api, WithCredentialsProvider(StaticCredentials("old-key", "new-key")))
+
+	// the request body is sent again with the secondary key
+	user, err := u.Update("user-1", UpdateUserOptions{Email: "a@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "a@example.com", user.Email)
+	assert.Equal(t, []string{"old-key", "new-key"}, api.keys())
+
+	api.mu.Lock()
+	api.accepted = "other-key"
+	api.mu.Unlock()
+
+	err = u.RevokeRefreshTokens("user-1")
+	var passageErr PassageError
+	require.ErrorAs(t, err, &passageErr)
+	assert.Equal(t, http.StatusUnauthorized, passageErr.StatusCode)
+}
+
+func TestCredentialsKeepUsingSecondaryKeyAfterFallback(t *testing.T) {
+	api := &keyCheckingAPI{api: newFakeAPI(t, PassageUser{ID: "user-1"}), accepted: "new-key"}
+	u := newTestUser(t, api, WithCredentialsProvider(StaticCredentials("old-key", "new-key")))
+
+	require.NoError(t, u.RevokeRefreshTokens("user-1"))
+	assert.Equal(t, []string{"old-key", "new-key"}, api.keys())
+
+	// the rejected primary key isn't tried again during the fallback period
+	require.NoError(t, u.RevokeRefreshTokens("user-1"))
+	assert.Equal(t, []string{"new-key"}, api.keys())
+
+	api.mu.Lock()
+	api.accepted = "old-key"
+	api.mu.Unlock()
+
+	// once the primary key is accepted again, it is used first
+	require.NoError(t, u.RevokeRefreshTokens("user-1"))
+	assert.Equal(t, []string{"new-key", "old-key"}, api.keys())
+
+	require.NoError(t, u.RevokeRefreshTokens("user-1"))
+	assert.Equal(t, []string{"old-key"}, api.keys())
+}
+
+func TestCredentialsFallbackIsRateLimited(t *testing.T) {
+	api := &keyCheckingAPI{api: newFakeAPI(t, PassageUser{ID: "user-1"}), accepted: "new-key"}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	cfg, err := newConfig([]Option{
+		WithCredentialsProvider(StaticCredentials("old-key", "new-key")),
+		WithRateLimit(RateLimitOptions{RateLimit: RateLimit{RequestsPerSecond: 1000}}),
+	})
+	require.NoError(t, err)
+
+	client, err := NewClientWithResponses(server.URL, WithHTTPClient(newHTTPClient(cfg)))
+	require.NoError(t, err)
+
+	require.NoError(t, newUser(testAppID, client, cfg).RevokeRefreshTokens("user-1"))
+	assert.Equal(t, []string{"old-key", "new-key"}, api.keys())
+	assert.Equal(t, int64(2), cfg.rateLimiter.snapshot().Requests)
+}
+
+func TestCredentialsWithoutSecondaryKeyDontRetry(t *testing.T) {
+	api := &keyCheckingAPI{api: newFakeAPI(t, PassageUser{ID: "user-1"}), accepted: "new-key"}
+	u := newTestUser(t, api, WithCredentialsProvider(StaticCredentials("old-key", "")))
+
+	assert.Error(t, u.RevokeRefreshTokens("user-1"))
+	assert.Equal(t, []string{"old-key"}, api.keys())
+}
+
+func TestEnvCredentialsAreReadPerRequest(t *testing.T) {
+	api := &keyCheckingAPI{api: newFakeAPI(t, PassageUser{ID: "user-1"}), accepted: "key-1"}
+	u := newTestUser(t, api, WithCredentialsProvider(EnvCredentials{Name: "TEST_PASSAGE_API_KEY"}))
+
+	t.Setenv("TEST_PASSAGE_API_KEY", "key-1")
+	require.NoError(t, u.RevokeRefreshTokens("user-1"))
+
+	api.mu.Lock()
+	api.accepted = "key-2"
+	api.mu.Unlock()
+
+	t.Setenv("TEST_PASSAGE_API_KEY", "key-2")
+	require.NoError(t, u.RevokeRefreshTokens("user-1"))
+	assert.Equal(t, []string{"key-1", "key-2"}, api.keys())
+
+	t.Setenv("TEST_PASSAGE_API_KEY", "")
+	assert.ErrorContains(t, u.RevokeRefreshTokens("user-1"), "TEST_PASSAGE_API_KEY")
+}
+
+func TestFileCredentialsReloadWhenFilesChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api-key")
+	secondaryPath := filepath.Join(dir, "secondary-api-key")
+	require.NoError(t, os.WriteFile(path, []byte("key-1\n"), 0o600))
+	require.NoError(t, os.WriteFile(secondaryPath, []byte("key-2\n"), 0o600))
+
+	creds, err := NewFileCredentials(path, &FileCredentialsOptions{SecondaryPath: secondaryPath, PollInterval: time.Minute})
+	require.NoError(t, err)
+
+	now := time.Now()
+	creds.now = func() time.Time { return now }
+
+	got, err := creds.Credentials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{APIKey: "key-1", SecondaryAPIKey: "key-2"}, got)
+
+	require.NoError(t, os.WriteFile(path, []byte("key-3\n"), 0o600))
+	require.NoError(t, os.Chtimes(path, now.Add(time.Hour), now.Add(time.Hour)))
+
+	// changes are only noticed once the poll interval has passed
+	got, _ = creds.Credentials(context.Background())
+	assert.Equal(t, "key-1", got.APIKey)
+
+	now = now.Add(time.Minute)
+	got, _ = creds.Credentials(context.Background())
+	assert.Equal(t, Credentials{APIKey: "key-3", SecondaryAPIKey: "key-2"}, got)
+
+	// a file that can't be read keeps the last keys
+	require.NoError(t, os.Remove(path))
+	now = now.Add(time.Minute)
+	got, _ = creds.Credentials(context.Background())
+	assert.Equal(t, "key-3", got.APIKey)
+}
+
+func TestNewFileCredentialsRequiresFile(t *testing.T) {
+	_, err := NewFileCredentials(filepath.Join(t.TempDir(), "missing"), nil)
+	assert.Error(t, err)
+
+	empty := filepath.Join(t.TempDir(), "empty")
+	require.NoError(t, os.WriteFile(empty, []byte("\n"), 0o600))
+	_, err = NewFileCredentials(empty, nil)
+	assert.Error(t, err)
+}
+
+func TestCredentialsFuncErrors(t *testing.T) {
+	api := &keyCheckingAPI{api: newFakeAPI(t, PassageUser{ID: "user-1"})}
+	u := newTestUser(t, api, WithCredentialsProvider(CredentialsFunc(func(context.Context) (Credentials, error) {
+		return Credentials{}, errors.New("vault is sealed")
+	})))
+
+	assert.ErrorContains(t, u.RevokeRefreshTokens("user-1"), "vault is sealed")
+	assert.Empty(t, api.keys())
+}
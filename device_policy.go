@@ -0,0 +1,290 @@
+package passage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DeviceViolationReason explains why a device violates a DevicePolicy.
+type DeviceViolationReason string
+
+const (
+	// DeviceIdle is reported for devices that have not been used for longer than DevicePolicy.MaxIdle.
+	DeviceIdle DeviceViolationReason = "idle"
+	// DeviceOverLimit is reported for the least recently used devices of users with more than
+	// DevicePolicy.MaxDevices devices.
+	DeviceOverLimit DeviceViolationReason = "over_limit"
+	// DeviceTypeDisallowed is reported for devices whose type is in DevicePolicy.DisallowedTypes.
+	DeviceTypeDisallowed DeviceViolationReason = "type_disallowed"
+)
+
+// DevicePolicyAction is what was done about a device violating a DevicePolicy.
+type DevicePolicyAction string
+
+const (
+	// DeviceFlagged means the violation was only reported.
+	DeviceFlagged DevicePolicyAction = "flagged"
+	// DeviceWouldRevoke means the device would have been revoked if the run was not a dry run.
+	DeviceWouldRevoke DevicePolicyAction = "would_revoke"
+	// DeviceRevoked means the device was revoked.
+	DeviceRevoked DevicePolicyAction = "revoked"
+	// DeviceRevokeFailed means revoking the device failed.
+	DeviceRevokeFailed DevicePolicyAction = "revoke_failed"
+)
+
+// DevicePolicy describes which webauthn devices users are allowed to keep. Zero-valued fields are not enforced.
+type DevicePolicy struct {
+	// MaxIdle is the longest a device may go unused. Devices that were never used to log in are measured from
+	// when they were created.
+	MaxIdle time.Duration
+	// MaxDevices is the most devices a user may have. The most recently used devices are kept, and devices
+	// violating the policy for another reason don't count toward the limit.
+	MaxDevices int
+	// DisallowedTypes lists the device types users may not have, such as SecurityKey.
+	DisallowedTypes []WebAuthnType
+}
+
+func (p DevicePolicy) validate() error {
+	if p.MaxIdle < 0 {
+		return errors.New("MaxIdle must not be negative.")
+	}
+
+	if p.MaxDevices < 0 {
+		return errors.New("MaxDevices must not be negative.")
+	}
+
+	if p.MaxIdle == 0 && p.MaxDevices == 0 && len(p.DisallowedTypes) == 0 {
+		return errors.New("policy must enforce at least one rule.")
+	}
+
+	return nil
+}
+
+// DeviceViolation is a device that violates a DevicePolicy.
+type DeviceViolation struct {
+	UserID  string
+	Device  WebAuthnDevices
+	Reasons []DeviceViolationReason
+	Action  DevicePolicyAction
+	// Err is set when Action is DeviceRevokeFailed.
+	Err error
+}
+
+// Evaluate returns the devices that violate the policy at now. The returned violations have no Action.
+func (p DevicePolicy) Evaluate(userID string, devices []WebAuthnDevices, now time.Time) []DeviceViolation {
+	violations := []DeviceViolation{}
+	compliant := []WebAuthnDevices{}
+
+	for _, device := range devices {
+		var reasons []DeviceViolationReason
+		if p.MaxIdle > 0 && now.Sub(lastUsed(device)) > p.MaxIdle {
+			reasons = append(reasons, DeviceIdle)
+		}
+		if slices.Contains(p.DisallowedTypes, device.Type) {
+			reasons = append(reasons, DeviceTypeDisallowed)
+		}
+
+		if len(reasons) > 0 {
+			violations = append(violations, DeviceViolation{UserID: userID, Device: device, Reasons: reasons})
+		} else {
+			compliant = append(compliant, device)
+		}
+	}
+
+	if p.MaxDevices > 0 && len(compliant) > p.MaxDevices {
+		slices.SortStableFunc(compliant, func(a, b WebAuthnDevices) int {
+			return lastUsed(b).Compare(lastUsed(a))
+		})
+
+		for _, device := range compliant[p.MaxDevices:] {
+			violations = append(violations, DeviceViolation{
+				UserID:  userID,
+				Device:  device,
+				Reasons: []DeviceViolationReason{DeviceOverLimit},
+			})
+		}
+	}
+
+	return violations
+}
+
+func lastUsed(device WebAuthnDevices) time.Time {
+	if device.LastLoginAt.IsZero() {
+		return device.CreatedAt
+	}
+
+	return device.LastLoginAt
+}
+
+// DevicePolicyOptions configures how a DevicePolicy is applied.
+type DevicePolicyOptions struct {
+	// BulkOptions limits how many users are processed at once and per second. With DryRun set, or under WithDryRun
+	// or CallDryRun, devices that would be revoked are reported without being revoked.
+	BulkOptions
+	// Revoke revokes violating devices. Otherwise violations are only flagged.
+	Revoke bool
+	// Audit, when set, receives a JSON object per line for every violation and the action taken.
+	Audit io.Writer
+}
+
+// DevicePolicyReport is the outcome of applying a DevicePolicy. Its BulkReport lists the users that were checked;
+// a user is in Failed if their devices could not be listed or any of their violating devices could not be revoked.
+type DevicePolicyReport struct {
+	BulkReport
+	Violations []DeviceViolation
+}
+
+type deviceAuditEntry struct {
+	Time         time.Time               `json:"time"`
+	UserID       string                  `json:"user_id"`
+	DeviceID     string                  `json:"device_id"`
+	DeviceType   WebAuthnType            `json:"device_type"`
+	FriendlyName string                  `json:"friendly_name"`
+	LastLoginAt  time.Time               `json:"last_login_at"`
+	Reasons      []DeviceViolationReason `json:"reasons"`
+	Action       DevicePolicyAction      `json:"action"`
+	Error        string                  `json:"error,omitempty"`
+}
+
+// ApplyDevicePolicy checks a user's devices against policy, revoking violating devices if opts.Revoke is set.
+// The report is returned even when err is set, since some devices may have been revoked.
+func (u *User) ApplyDevicePolicy(
+	ctx context.Context,
+	userID string,
+	policy DevicePolicy,
+	opts *DevicePolicyOptions,
+) (*DevicePolicyReport, error) {
+	if userID == "" {
+		return nil, errors.New("userID is required.")
+	}
+
+	report, err := u.applyDevicePolicy(ctx, []string{userID}, policy, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, report.Failed[userID]
+}
+
+// ApplyDevicePolicyWhere checks the devices of every user matching query against policy, revoking violating
+// devices if opts.Revoke is set. Failures for individual users are collected in the report; the returned error
+// is only set if the policy is invalid or the matching users could not be listed.
+func (u *User) ApplyDevicePolicyWhere(
+	ctx context.Context,
+	query UserQuery,
+	policy DevicePolicy,
+	opts *DevicePolicyOptions,
+) (*DevicePolicyReport, error) {
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+
+	ids, err := u.listUserIDs(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.applyDevicePolicy(ctx, ids, policy, opts)
+}
+
+func (u *User) applyDevicePolicy(
+	ctx context.Context,
+	ids []string,
+	policy DevicePolicy,
+	opts *DevicePolicyOptions,
+) (*DevicePolicyReport, error) {
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+
+	var options DevicePolicyOptions
+	if opts != nil {
+		options = *opts
+	}
+
+	// devices are listed even for a dry run, so runBulk must always run
+	bulkOptions := options.BulkOptions
+	bulkOptions.DryRun = false
+
+	var mu sync.Mutex
+	violations := []DeviceViolation{}
+
+	bulkReport := runBulk(ctx, ids, &bulkOptions, func(ctx context.Context, userID string) error {
+		devices, err := u.listDevices(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		var errs []error
+		userViolations := policy.Evaluate(userID, devices, time.Now())
+		for i := range userViolations {
+			violation := &userViolations[i]
+
+			switch {
+			case !options.Revoke:
+				violation.Action = DeviceFlagged
+			case options.DryRun:
+				violation.Action = DeviceWouldRevoke
+			default:
+				// under WithDryRun or CallDryRun, revokeDevice is a dry run itself
+				if err := u.revokeDevice(ctx, userID, violation.Device.ID); err != nil {
+					violation.Action = DeviceRevokeFailed
+					violation.Err = err
+					errs = append(errs, fmt.Errorf("failed to revoke device %q: %w", violation.Device.ID, err))
+				} else if u.isDryRun(ctx) {
+					violation.Action = DeviceWouldRevoke
+				} else {
+					violation.Action = DeviceRevoked
+				}
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		violations = append(violations, userViolations...)
+		if err := writeDeviceAudit(options.Audit, userViolations); err != nil {
+			errs = append(errs, err)
+		}
+
+		return errors.Join(errs...)
+	})
+	bulkReport.DryRun = options.DryRun || u.isDryRun(ctx)
+
+	return &DevicePolicyReport{BulkReport: *bulkReport, Violations: violations}, nil
+}
+
+func writeDeviceAudit(w io.Writer, violations []DeviceViolation) error {
+	if w == nil {
+		return nil
+	}
+
+	encoder := json.NewEncoder(w)
+	for _, violation := range violations {
+		entry := deviceAuditEntry{
+			Time:         time.Now(),
+			UserID:       violation.UserID,
+			DeviceID:     violation.Device.ID,
+			DeviceType:   violation.Device.Type,
+			FriendlyName: violation.Device.FriendlyName,
+			LastLoginAt:  violation.Device.LastLoginAt,
+			Reasons:      violation.Reasons,
+			Action:       violation.Action,
+		}
+		if violation.Err != nil {
+			entry.Error = violation.Err.Error()
+		}
+
+		if err := encoder.Encode(entry); err != nil {
+			return fmt.Errorf("failed to write device policy audit: %w", err)
+		}
+	}
+
+	return nil
+}
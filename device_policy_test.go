@@ -0,0 +1,146 @@
+package passage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevicePolicyEvaluate(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	devices := []WebAuthnDevices{
+		{ID: "recent", Type: Passkey, LastLoginAt: now.Add(-time.Hour)},
+		{ID: "older", Type: Passkey, LastLoginAt: now.Add(-48 * time.Hour)},
+		{ID: "unused", Type: Platform, CreatedAt: now.AddDate(0, 0, -100)},
+		{ID: "key", Type: SecurityKey, LastLoginAt: now.Add(-time.Hour)},
+		{ID: "oldest", Type: Platform, LastLoginAt: now.AddDate(0, 0, -10)},
+	}
+
+	policy := DevicePolicy{
+		MaxIdle:         30 * 24 * time.Hour,
+		MaxDevices:      2,
+		DisallowedTypes: []WebAuthnType{SecurityKey},
+	}
+
+	reasons := map[string][]DeviceViolationReason{}
+	for _, violation := range policy.Evaluate("user-1", devices, now) {
+		assert.Equal(t, "user-1", violation.UserID)
+		reasons[violation.Device.ID] = violation.Reasons
+	}
+
+	assert.Equal(t, map[string][]DeviceViolationReason{
+		"unused": {DeviceIdle},
+		"key":    {DeviceTypeDisallowed},
+		"oldest": {DeviceOverLimit},
+	}, reasons)
+}
+
+func TestDevicePolicyRequiresARule(t *testing.T) {
+	u := newTestUser(t, newFakeAPI(t))
+
+	_, err := u.ApplyDevicePolicy(context.Background(), "user-1", DevicePolicy{}, nil)
+	assert.Error(t, err)
+}
+
+func newDevicePolicyTestAPI(t *testing.T) *fakeAPI {
+	now := time.Now()
+
+	return newFakeAPI(t,
+		PassageUser{ID: "user-1", Status: StatusActive, WebauthnDevices: []WebAuthnDevices{
+			{ID: "device-1", Type: Passkey, LastLoginAt: now},
+			{ID: "device-2", Type: SecurityKey, LastLoginAt: now},
+		}},
+		PassageUser{ID: "user-2", Status: StatusActive, WebauthnDevices: []WebAuthnDevices{
+			{ID: "device-3", Type: SecurityKey, LastLoginAt: now},
+		}},
+		PassageUser{ID: "user-3", Status: StatusActive, WebauthnDevices: []WebAuthnDevices{
+			{ID: "device-4", Type: Passkey, LastLoginAt: now},
+		}},
+	)
+}
+
+func TestApplyDevicePolicyWhereRevokesAndAudits(t *testing.T) {
+	api := newDevicePolicyTestAPI(t)
+	u := newTestUser(t, api)
+	policy := DevicePolicy{DisallowedTypes: []WebAuthnType{SecurityKey}}
+
+	var audit bytes.Buffer
+	report, err := u.ApplyDevicePolicyWhere(context.Background(), UserQuery{}, policy, &DevicePolicyOptions{
+		BulkOptions: BulkOptions{Concurrency: 2},
+		Revoke:      true,
+		Audit:       &audit,
+	})
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"user-1", "user-2", "user-3"}, report.Succeeded)
+	assert.Empty(t, report.Failed)
+	require.Len(t, report.Violations, 2)
+	for _, violation := range report.Violations {
+		assert.Equal(t, DeviceRevoked, violation.Action)
+	}
+	assert.Equal(t, 2, api.count("revoke_device"))
+
+	user, _ := api.user("user-1")
+	assert.Len(t, user.WebauthnDevices, 1)
+
+	lines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var entry deviceAuditEntry
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, DeviceRevoked, entry.Action)
+	assert.Equal(t, []DeviceViolationReason{DeviceTypeDisallowed}, entry.Reasons)
+}
+
+func TestApplyDevicePolicyDryRunAndFlag(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   *DevicePolicyOptions
+		action DevicePolicyAction
+	}{
+		{name: "flag", opts: nil, action: DeviceFlagged},
+		{name: "dry run", opts: &DevicePolicyOptions{Revoke: true, BulkOptions: BulkOptions{DryRun: true}}, action: DeviceWouldRevoke},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newDevicePolicyTestAPI(t)
+			u := newTestUser(t, api)
+
+			report, err := u.ApplyDevicePolicy(context.Background(), "user-1", DevicePolicy{MaxDevices: 1}, tt.opts)
+			require.NoError(t, err)
+
+			require.Len(t, report.Violations, 1)
+			assert.Equal(t, tt.action, report.Violations[0].Action)
+			assert.Equal(t, []DeviceViolationReason{DeviceOverLimit}, report.Violations[0].Reasons)
+			assert.Equal(t, 0, api.count("revoke_device"))
+		})
+	}
+}
+
+func TestApplyDevicePolicyReportsRevokeFailures(t *testing.T) {
+	api := newDevicePolicyTestAPI(t)
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			writeJSON(t, w, http.StatusInternalServerError, N500Error{Code: InternalServerError, Error: "boom"})
+			return
+		}
+		api.ServeHTTP(w, r)
+	}))
+
+	policy := DevicePolicy{DisallowedTypes: []WebAuthnType{SecurityKey}}
+	report, err := u.ApplyDevicePolicy(context.Background(), "user-2", policy, &DevicePolicyOptions{Revoke: true})
+	require.Error(t, err)
+
+	require.Len(t, report.Violations, 1)
+	assert.Equal(t, DeviceRevokeFailed, report.Violations[0].Action)
+	assert.Error(t, report.Violations[0].Err)
+	assert.Contains(t, report.Failed, "user-2")
+}
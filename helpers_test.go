@@ -0,0 +1,321 @@
+package passage
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/stretchr/testify/require"
+)
+
+const testAppID = "test-app"
+
+// newTestUser returns a User that talks to a local server serving handler.
+func newTestUser(t *testing.T, handler http.Handler, opts ...Option) *User {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg, err := newConfig(opts)
+	require.NoError(t, err)
+
+	client, err := NewClientWithResponses(server.URL, WithHTTPClient(newHTTPClient(cfg)))
+	require.NoError(t, err)
+
+	return newUser(testAppID, client, cfg)
+}
+
+// testSigner issues JWTs accepted by an Auth created with newTestAuth.
+type testSigner struct {
+	t   *testing.T
+	key *rsa.PrivateKey
+}
+
+// newTestAuth returns an Auth whose JWKS holds a freshly generated key, so no JWKS is fetched over the network.
+// Its User, if any is needed, is set by the caller.
+func newTestAuth(t *testing.T, opts ...Option) (*Auth, *testSigner) {
+	t.Helper()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	key, err := jwk.Import(privateKey.Public())
+	require.NoError(t, err)
+	require.NoError(t, key.Set(jwk.KeyIDKey, "test-kid"))
+
+	set := jwk.NewSet()
+	require.NoError(t, set.AddKey(key))
+
+	cfg, err := newConfig(opts)
+	require.NoError(t, err)
+
+	auth := newAuthWithJWKS(testAppID, nil, set, nil, cfg)
+
+	return auth, &testSigner{t: t, key: privateKey}
+}
+
+// sign returns a JWT for userID issued at issuedAt.
+func (s *testSigner) sign(userID string, issuedAt time.Time) string {
+	s.t.Helper()
+
+	token := gojwt.NewWithClaims(gojwt.SigningMethodRS256, gojwt.MapClaims{
+		"sub": userID,
+		"aud": testAppID,
+		"iat": issuedAt.Unix(),
+		"exp": issuedAt.Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = "test-kid"
+
+	signed, err := token.SignedString(s.key)
+	require.NoError(s.t, err)
+
+	return signed
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, statusCode int, body any) {
+	t.Helper()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	require.NoError(t, json.NewEncoder(w).Encode(body))
+}
+
+// fakeAPI is an in-memory stand-in for the parts of the Passage API used by User.
+type fakeAPI struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	users    map[string]*PassageUser
+	requests map[string]int
+	nextID   int
+	// beforeCreate, when set, runs before a user is created and can be used to simulate races.
+	beforeCreate func(args CreateUserArgs)
+}
+
+func newFakeAPI(t *testing.T, users ...PassageUser) *fakeAPI {
+	api := &fakeAPI{
+		t:        t,
+		users:    map[string]*PassageUser{},
+		requests: map[string]int{},
+	}
+
+	for i := range users {
+		api.users[users[i].ID] = &users[i]
+	}
+
+	return api
+}
+
+func (f *fakeAPI) count(operation string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.requests[operation]
+}
+
+func (f *fakeAPI) user(userID string) (PassageUser, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.users[userID]
+	if !ok {
+		return PassageUser{}, false
+	}
+
+	return *user, true
+}
+
+func (f *fakeAPI) add(user PassageUser) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.users[user.ID] = &user
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := fmt.Sprintf("/apps/%s/users", testAppID)
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/"), "/")
+	if segments[0] == "" {
+		segments = nil
+	}
+
+	switch {
+	case len(segments) == 0 && r.Method == http.MethodGet:
+		f.list(w, r)
+	case len(segments) == 0 && r.Method == http.MethodPost:
+		f.create(w, r)
+	case len(segments) == 1 && r.Method == http.MethodGet:
+		f.withUser(w, "get", segments[0], func(user *PassageUser) (int, any) {
+			return http.StatusOK, UserResponse{PassageUser: *user}
+		})
+	case len(segments) == 1 && r.Method == http.MethodPatch:
+		var body UpdateUserOptions
+		require.NoError(f.t, json.NewDecoder(r.Body).Decode(&body))
+		f.withUser(w, "update", segments[0], func(user *PassageUser) (int, any) {
+			if body.Email != "" {
+				user.Email = body.Email
+			}
+			if body.Phone != "" {
+				user.Phone = body.Phone
+			}
+			if body.UserMetadata != nil {
+				user.UserMetadata = body.UserMetadata
+			}
+			user.UpdatedAt = user.UpdatedAt.Add(time.Second)
+			return http.StatusOK, UserResponse{PassageUser: *user}
+		})
+	case len(segments) == 1 && r.Method == http.MethodDelete:
+		f.withUser(w, "delete", segments[0], func(user *PassageUser) (int, any) {
+			delete(f.users, user.ID)
+			return http.StatusOK, struct{}{}
+		})
+	case len(segments) == 2 && segments[1] == "activate":
+		f.withUser(w, "activate", segments[0], func(user *PassageUser) (int, any) {
+			user.Status = StatusActive
+			return http.StatusOK, UserResponse{PassageUser: *user}
+		})
+	case len(segments) == 2 && segments[1] == "deactivate":
+		f.withUser(w, "deactivate", segments[0], func(user *PassageUser) (int, any) {
+			user.Status = StatusInactive
+			return http.StatusOK, UserResponse{PassageUser: *user}
+		})
+	case len(segments) == 2 && segments[1] == "tokens":
+		f.withUser(w, "revoke_tokens", segments[0], func(user *PassageUser) (int, any) {
+			return http.StatusOK, struct{}{}
+		})
+	case len(segments) == 2 && segments[1] == "devices":
+		f.withUser(w, "list_devices", segments[0], func(user *PassageUser) (int, any) {
+			return http.StatusOK, ListDevicesResponse{Devices: user.WebauthnDevices}
+		})
+	case len(segments) == 3 && segments[1] == "devices" && r.Method == http.MethodDelete:
+		f.withUser(w, "revoke_device", segments[0], func(user *PassageUser) (int, any) {
+			for i, device := range user.WebauthnDevices {
+				if device.ID == segments[2] {
+					user.WebauthnDevices = append(user.WebauthnDevices[:i], user.WebauthnDevices[i+1:]...)
+					return http.StatusOK, struct{}{}
+				}
+			}
+			return http.StatusNotFound, N404Error{Code: DeviceNotFound, Error: "device not found"}
+		})
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeAPI) withUser(w http.ResponseWriter, operation string, userID string, fn func(user *PassageUser) (int, any)) {
+	f.mu.Lock()
+	f.requests[operation]++
+	user, ok := f.users[userID]
+
+	var statusCode int
+	var body any
+	if ok {
+		statusCode, body = fn(user)
+	} else {
+		statusCode, body = http.StatusNotFound, N404Error{Code: UserNotFound, Error: "user not found"}
+	}
+	f.mu.Unlock()
+
+	writeJSON(f.t, w, statusCode, body)
+}
+
+func (f *fakeAPI) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	f.mu.Lock()
+	f.requests["list"]++
+
+	users := make([]*PassageUser, 0, len(f.users))
+	for _, user := range f.users {
+		if identifier := query.Get("identifier"); identifier != "" &&
+			identifier != strings.ToLower(user.Email) && identifier != user.Phone {
+			continue
+		}
+		if status := query.Get("status"); status != "" && status != string(user.Status) {
+			continue
+		}
+		if createdBefore := query.Get("created_before"); createdBefore != "" {
+			unix, err := strconv.ParseInt(createdBefore, 10, 64)
+			require.NoError(f.t, err)
+			if !user.CreatedAt.Before(time.Unix(unix, 0)) {
+				continue
+			}
+		}
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	page, limit := 1, len(users)
+	if value := query.Get("page"); value != "" {
+		page, _ = strconv.Atoi(value)
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, _ = strconv.Atoi(value)
+	}
+
+	items := []ListPaginatedUsersItem{}
+	for i := (page - 1) * limit; i < len(users) && i < page*limit; i++ {
+		user := users[i]
+		items = append(items, ListPaginatedUsersItem{
+			ID:           user.ID,
+			Email:        user.Email,
+			Phone:        user.Phone,
+			Status:       user.Status,
+			CreatedAt:    user.CreatedAt,
+			UpdatedAt:    user.UpdatedAt,
+			LastLoginAt:  user.LastLoginAt,
+			LoginCount:   user.LoginCount,
+			UserMetadata: &user.UserMetadata,
+		})
+	}
+	f.mu.Unlock()
+
+	writeJSON(f.t, w, http.StatusOK, paginatedUsersResponse{Users: items, Page: page, Limit: limit, TotalUsers: int64(len(users))})
+}
+
+func (f *fakeAPI) create(w http.ResponseWriter, r *http.Request) {
+	var args CreateUserArgs
+	require.NoError(f.t, json.NewDecoder(r.Body).Decode(&args))
+
+	if f.beforeCreate != nil {
+		f.beforeCreate(args)
+	}
+
+	f.mu.Lock()
+	f.requests["create"]++
+
+	for _, user := range f.users {
+		if (args.Email != "" && strings.EqualFold(args.Email, user.Email)) || (args.Phone != "" && args.Phone == user.Phone) {
+			f.mu.Unlock()
+			writeJSON(f.t, w, http.StatusConflict, map[string]string{"code": "user_already_exists", "error": "user already exists"})
+			return
+		}
+	}
+
+	f.nextID++
+	user := &PassageUser{
+		ID:           fmt.Sprintf("created-%d", f.nextID),
+		Email:        args.Email,
+		Phone:        args.Phone,
+		Status:       StatusActive,
+		UserMetadata: args.UserMetadata,
+	}
+	f.users[user.ID] = user
+	created := *user
+	f.mu.Unlock()
+
+	writeJSON(f.t, w, http.StatusCreated, UserResponse{PassageUser: created})
+}
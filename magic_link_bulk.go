@@ -0,0 +1,247 @@
+package passage
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// BulkMagicLinkRecipient is a recipient of CreateMagicLinksBulk.
+type BulkMagicLinkRecipient struct {
+	MagicLinkRecipient
+	// Options, such as the recipient's language and redirect, override BulkMagicLinkOptions.Defaults. Only the fields
+	// that are set override the default; the others keep it.
+	Options *MagicLinkOptions
+}
+
+// BulkMagicLinkOptions configures CreateMagicLinksBulk.
+type BulkMagicLinkOptions struct {
+	// BulkOptions limits how many magic links are created at once and per second. With DryRun set, recipients and
+	// their options are validated without creating any magic link.
+	BulkOptions
+	Type MagicLinkType
+	// Send has Passage send every magic link.
+	Send bool
+	// Deliver delivers every magic link through the Sender configured with WithMagicLinkSender instead.
+	Deliver bool
+	// Defaults are the magic link options of every recipient, for the fields the recipient doesn't set itself.
+	Defaults *MagicLinkOptions
+	// OnResult, when set, is called with each result as soon as it is known. Calls are not concurrent.
+	OnResult func(result MagicLinkResult)
+}
+
+// MagicLinkResult is the outcome of creating a magic link for one recipient.
+type MagicLinkResult struct {
+	// Index is the position of the recipient in the list passed to CreateMagicLinksBulk.
+	Index     int
+	Recipient BulkMagicLinkRecipient
+	// Language is the language chosen for the recipient's magic link.
+	Language MagicLinkLanguage
+	// MagicLink is the created magic link. It is nil for a dry run and may be set along with Err if delivery failed.
+	MagicLink *MagicLink
+	Err       error
+}
+
+// MagicLinkBulkReport is the outcome of CreateMagicLinksBulk.
+type MagicLinkBulkReport struct {
+	DryRun bool
+	// Results holds a result for every recipient, in the order the recipients were given.
+	Results []MagicLinkResult
+}
+
+// Failed returns the results that have an error.
+func (r *MagicLinkBulkReport) Failed() []MagicLinkResult {
+	failed := []MagicLinkResult{}
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+
+	return failed
+}
+
+// CreateMagicLinksBulk creates a magic link for every recipient, for example to invite a whole team. Failures for
+// individual recipients are collected in the report rather than stopping the operation; the returned error is only
+// set if opts are invalid, or if ctx is part of a dry run other than the one BulkOptions.DryRun asks for.
+func (a *Auth) CreateMagicLinksBulk(
+	ctx context.Context,
+	recipients []BulkMagicLinkRecipient,
+	opts *BulkMagicLinkOptions,
+) (*MagicLinkBulkReport, error) {
+	var options BulkMagicLinkOptions
+	if opts != nil {
+		options = *opts
+	}
+
+	if options.Send && options.Deliver {
+		return nil, errors.New("only one of Send and Deliver may be set.")
+	}
+
+	if options.Deliver && a.sender == nil {
+		return nil, errors.New("no magic link sender is configured, use WithMagicLinkSender.")
+	}
+
+	// the bulk operation's own dry run only validates, so it is the one kind of dry run it supports
+	if !options.DryRun {
+		if err := a.checkDryRun(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &MagicLinkBulkReport{
+		DryRun:  options.DryRun,
+		Results: make([]MagicLinkResult, len(recipients)),
+	}
+
+	for i, recipient := range recipients {
+		report.Results[i] = MagicLinkResult{
+			Index:     i,
+			Recipient: recipient,
+			Language:  recipient.options(&options).language(),
+		}
+	}
+
+	var mu sync.Mutex
+	finish := func(i int, link *MagicLink, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		report.Results[i].MagicLink = link
+		report.Results[i].Err = err
+		if options.OnResult != nil {
+			options.OnResult(report.Results[i])
+		}
+	}
+
+	if options.DryRun {
+		for i, recipient := range recipients {
+			finish(i, nil, a.validateBulkMagicLink(recipient, &options))
+		}
+
+		return report, nil
+	}
+
+	forEachBulk(ctx, len(recipients), options.BulkOptions, func(ctx context.Context, i int) error {
+		link, err := a.createBulkMagicLink(ctx, recipients[i], &options)
+		finish(i, link, err)
+		return err
+	}, func(i int, err error) {
+		// recipients that were never attempted because ctx was done
+		mu.Lock()
+		attempted := report.Results[i].MagicLink != nil || report.Results[i].Err != nil
+		mu.Unlock()
+
+		if !attempted && err != nil {
+			finish(i, nil, err)
+		}
+	})
+
+	return report, nil
+}
+
+func (a *Auth) validateBulkMagicLink(recipient BulkMagicLinkRecipient, opts *BulkMagicLinkOptions) error {
+	if _, err := recipient.magicLinkArgs(opts.Type); err != nil {
+		return err
+	}
+
+	return a.validateMagicLinkOptions(recipient.options(opts))
+}
+
+func (a *Auth) createBulkMagicLink(ctx context.Context, recipient BulkMagicLinkRecipient, opts *BulkMagicLinkOptions) (*MagicLink, error) {
+	if opts.Deliver {
+		return a.SendMagicLink(ctx, recipient.MagicLinkRecipient, opts.Type, recipient.options(opts))
+	}
+
+	args, err := recipient.magicLinkArgs(opts.Type)
+	if err != nil {
+		return nil, err
+	}
+	args.Send = opts.Send
+
+	return a.createMagicLink(ctx, args, recipient.options(opts))
+}
+
+// options returns the recipient's magic link options: the defaults, with every field the recipient sets overriding
+// the default.
+func (r BulkMagicLinkRecipient) options(opts *BulkMagicLinkOptions) *MagicLinkOptions {
+	if r.Options == nil {
+		return opts.Defaults
+	}
+
+	if opts.Defaults == nil {
+		return r.Options
+	}
+
+	merged := *opts.Defaults
+	if r.Options.Language != "" {
+		merged.Language = r.Options.Language
+	}
+	if r.Options.AcceptLanguage != "" {
+		merged.AcceptLanguage = r.Options.AcceptLanguage
+	}
+	if r.Options.MagicLinkPath != "" {
+		merged.MagicLinkPath = r.Options.MagicLinkPath
+	}
+	if r.Options.RedirectURL != "" {
+		merged.RedirectURL = r.Options.RedirectURL
+	}
+	// TTL and TTLDuration are alternatives, so a recipient setting either replaces both defaults
+	if r.Options.TTL != 0 || r.Options.TTLDuration != 0 {
+		merged.TTL = r.Options.TTL
+		merged.TTLDuration = r.Options.TTLDuration
+	}
+
+	return &merged
+}
+
+// WriteCSV writes the report as CSV with a header row and a row per recipient, including the created links and
+// the errors of failed recipients.
+func (r *MagicLinkBulkReport) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"index", "email", "phone", "user_id", "language", "status", "magic_link_id", "url", "error"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, result := range r.Results {
+		status := "created"
+		switch {
+		case result.Err != nil:
+			status = "failed"
+		case r.DryRun:
+			status = "valid"
+		}
+
+		var linkID, url, errMessage string
+		if result.MagicLink != nil {
+			linkID, url = result.MagicLink.ID, result.MagicLink.URL
+		}
+		if result.Err != nil {
+			errMessage = result.Err.Error()
+		}
+
+		recipient := result.Recipient
+		row := []string{
+			strconv.Itoa(result.Index),
+			recipient.Email,
+			recipient.Phone,
+			recipient.UserID,
+			string(result.Language),
+			status,
+			linkID,
+			url,
+			errMessage,
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,197 @@
+package passage
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBulkMagicLinkTestAuth returns an Auth creating magic links against a local server that fails for
+// identifiers starting with "fail" and records the requests it receives.
+func newBulkMagicLinkTestAuth(t *testing.T, opts ...Option) (*Auth, *atomic.Int32, func() []magicLinkArgs) {
+	t.Helper()
+
+	var requests atomic.Int32
+	var mu sync.Mutex
+	var received []magicLinkArgs
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		var args magicLinkArgs
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&args))
+		mu.Lock()
+		received = append(received, args)
+		mu.Unlock()
+
+		identifier := args.Email + args.Phone + args.UserID
+		if strings.HasPrefix(identifier, "fail") {
+			writeJSON(t, w, http.StatusBadRequest, N400Error{Code: "invalid_request", Error: "bad identifier"})
+			return
+		}
+
+		writeJSON(t, w, http.StatusCreated, MagicLinkResponse{MagicLink: MagicLink{
+			ID:         "link-" + identifier,
+			Identifier: identifier,
+			URL:        "https://app.example.com/magic?id=" + identifier,
+		}})
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClientWithResponses(server.URL)
+	require.NoError(t, err)
+
+	auth, _ := newTestAuth(t, opts...)
+	auth.client = client
+
+	return auth, &requests, func() []magicLinkArgs {
+		mu.Lock()
+		defer mu.Unlock()
+		return received
+	}
+}
+
+func TestCreateMagicLinksBulk(t *testing.T) {
+	auth, requests, received := newBulkMagicLinkTestAuth(t)
+
+	recipients := []BulkMagicLinkRecipient{
+		{MagicLinkRecipient: MagicLinkRecipient{Email: "a@example.com"}},
+		{
+			MagicLinkRecipient: MagicLinkRecipient{Phone: "+15005550006"},
+			Options:            &MagicLinkOptions{Language: Pt, RedirectURL: "/welcome"},
+		},
+		{MagicLinkRecipient: MagicLinkRecipient{Email: "fail@example.com"}},
+		{MagicLinkRecipient: MagicLinkRecipient{UserID: "user-1", Channel: EmailChannel}},
+		{MagicLinkRecipient: MagicLinkRecipient{}},
+	}
+
+	var streamed []int
+	report, err := auth.CreateMagicLinksBulk(context.Background(), recipients, &BulkMagicLinkOptions{
+		BulkOptions: BulkOptions{Concurrency: 2, RateLimit: 1000},
+		Type:        LoginType,
+		Send:        true,
+		Defaults:    &MagicLinkOptions{Language: De},
+		OnResult:    func(result MagicLinkResult) { streamed = append(streamed, result.Index) },
+	})
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []int{0, 1, 2, 3, 4}, streamed)
+	require.Len(t, report.Results, 5)
+	assert.Equal(t, "link-a@example.com", report.Results[0].MagicLink.ID)
+	assert.Equal(t, De, report.Results[0].Language)
+	assert.Equal(t, Pt, report.Results[1].Language)
+	assert.Error(t, report.Results[2].Err)
+	assert.Equal(t, "link-user-1", report.Results[3].MagicLink.ID)
+	assert.Error(t, report.Results[4].Err)
+	assert.Len(t, report.Failed(), 2)
+	assert.Equal(t, int32(4), requests.Load())
+
+	for _, args := range received() {
+		assert.True(t, args.Send)
+		if args.Phone != "" {
+			assert.Equal(t, "/welcome", args.RedirectURL)
+			assert.Equal(t, Pt, args.Language)
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteCSV(&buf))
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 6)
+	assert.Equal(t, []string{"index", "email", "phone", "user_id", "language", "status", "magic_link_id", "url", "error"}, rows[0])
+	assert.Equal(t, []string{"0", "a@example.com", "", "", "de", "created", "link-a@example.com", "https://app.example.com/magic?id=a@example.com", ""}, rows[1])
+	assert.Equal(t, "failed", rows[3][5])
+	assert.NotEmpty(t, rows[3][8])
+}
+
+func TestCreateMagicLinksBulkDryRun(t *testing.T) {
+	auth, requests, _ := newBulkMagicLinkTestAuth(t, WithRedirectAllowList(RedirectAllowList{Paths: []string{"/welcome"}}))
+
+	recipients := []BulkMagicLinkRecipient{
+		{MagicLinkRecipient: MagicLinkRecipient{Email: "a@example.com"}},
+		{MagicLinkRecipient: MagicLinkRecipient{Email: "b@example.com"}, Options: &MagicLinkOptions{RedirectURL: "/admin"}},
+	}
+
+	report, err := auth.CreateMagicLinksBulk(context.Background(), recipients, &BulkMagicLinkOptions{
+		BulkOptions: BulkOptions{DryRun: true},
+		Defaults:    &MagicLinkOptions{RedirectURL: "/welcome"},
+	})
+	require.NoError(t, err)
+
+	assert.True(t, report.DryRun)
+	assert.NoError(t, report.Results[0].Err)
+	assert.Nil(t, report.Results[0].MagicLink)
+	assert.ErrorIs(t, report.Results[1].Err, ErrRedirectNotAllowed)
+	assert.Equal(t, int32(0), requests.Load())
+}
+
+func TestCreateMagicLinksBulkMergesRecipientOptionsIntoDefaults(t *testing.T) {
+	auth, _, received := newBulkMagicLinkTestAuth(t)
+
+	recipients := []BulkMagicLinkRecipient{
+		{MagicLinkRecipient: MagicLinkRecipient{Email: "a@example.com"}, Options: &MagicLinkOptions{Language: Pt}},
+		{MagicLinkRecipient: MagicLinkRecipient{Email: "b@example.com"}, Options: &MagicLinkOptions{TTL: 5}},
+	}
+
+	report, err := auth.CreateMagicLinksBulk(context.Background(), recipients, &BulkMagicLinkOptions{
+		Type:     LoginType,
+		Defaults: &MagicLinkOptions{Language: De, RedirectURL: "/welcome", TTLDuration: time.Hour},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, report.Failed())
+
+	byEmail := map[string]magicLinkArgs{}
+	for _, args := range received() {
+		byEmail[args.Email] = args
+	}
+
+	assert.Equal(t, Pt, byEmail["a@example.com"].Language)
+	assert.Equal(t, "/welcome", byEmail["a@example.com"].RedirectURL)
+	assert.Equal(t, 60, byEmail["a@example.com"].TTL)
+
+	assert.Equal(t, De, byEmail["b@example.com"].Language)
+	assert.Equal(t, "/welcome", byEmail["b@example.com"].RedirectURL)
+	assert.Equal(t, 5, byEmail["b@example.com"].TTL)
+}
+
+func TestCreateMagicLinksBulkCanceled(t *testing.T) {
+	auth, _, _ := newBulkMagicLinkTestAuth(t)
+
+	recipients := make([]BulkMagicLinkRecipient, 5)
+	for i := range recipients {
+		recipients[i].Email = fmt.Sprintf("user-%d@example.com", i)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report, err := auth.CreateMagicLinksBulk(ctx, recipients, nil)
+	require.NoError(t, err)
+
+	for _, result := range report.Results {
+		assert.ErrorIs(t, result.Err, context.Canceled)
+	}
+}
+
+func TestCreateMagicLinksBulkValidatesOptions(t *testing.T) {
+	auth, _, _ := newBulkMagicLinkTestAuth(t)
+
+	_, err := auth.CreateMagicLinksBulk(context.Background(), nil, &BulkMagicLinkOptions{Send: true, Deliver: true})
+	assert.Error(t, err)
+
+	_, err = auth.CreateMagicLinksBulk(context.Background(), nil, &BulkMagicLinkOptions{Deliver: true})
+	assert.Error(t, err)
+}
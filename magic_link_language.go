@@ -0,0 +1,84 @@
+package passage
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var supportedMagicLinkLanguages = []MagicLinkLanguage{De, En, Es, It, Pl, Pt, Zh}
+
+// NegotiateMagicLinkLanguage picks the supported MagicLinkLanguage the Accept-Language header value prefers
+// most. Regional and script variants such as "pt-BR" and "zh-Hant" match their base language. fallback is
+// returned when no supported language is acceptable.
+func NegotiateMagicLinkLanguage(acceptLanguage string, fallback MagicLinkLanguage) MagicLinkLanguage {
+	type preference struct {
+		tag     string
+		quality float64
+	}
+
+	var preferences []preference
+	for _, entry := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(entry), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.TrimSpace(key) != "q" {
+				continue
+			}
+
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || q < 0 || q > 1 {
+				q = 0
+			}
+			quality = q
+		}
+
+		if quality > 0 {
+			preferences = append(preferences, preference{tag: tag, quality: quality})
+		}
+	}
+
+	// equally preferred languages keep the order they were listed in
+	slices.SortStableFunc(preferences, func(a, b preference) int {
+		switch {
+		case a.quality > b.quality:
+			return -1
+		case a.quality < b.quality:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	for _, preference := range preferences {
+		if preference.tag == "*" {
+			return fallback
+		}
+
+		base, _, _ := strings.Cut(strings.ReplaceAll(preference.tag, "_", "-"), "-")
+		if language := MagicLinkLanguage(base); slices.Contains(supportedMagicLinkLanguages, language) {
+			return language
+		}
+	}
+
+	return fallback
+}
+
+// language returns the language magic links created with opts are sent in.
+func (opts *MagicLinkOptions) language() MagicLinkLanguage {
+	if opts == nil {
+		return ""
+	}
+
+	if opts.AcceptLanguage != "" {
+		return NegotiateMagicLinkLanguage(opts.AcceptLanguage, opts.Language)
+	}
+
+	return opts.Language
+}
@@ -0,0 +1,52 @@
+package passage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateMagicLinkLanguage(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		want           MagicLinkLanguage
+	}{
+		{acceptLanguage: "de", want: De},
+		{acceptLanguage: "pt-BR,pt;q=0.9,en;q=0.8", want: Pt},
+		{acceptLanguage: "zh-Hant-TW", want: Zh},
+		{acceptLanguage: "zh_CN", want: Zh},
+		{acceptLanguage: "fr-FR, fr;q=0.9, es;q=0.8, en;q=0.7", want: Es},
+		{acceptLanguage: "en;q=0.5, it;q=0.8", want: It},
+		{acceptLanguage: "PL", want: Pl},
+		{acceptLanguage: "es;q=0, en;q=0.1", want: En},
+		{acceptLanguage: "fr, *;q=0.5", want: Es},
+		{acceptLanguage: "fr, ja", want: Es},
+		{acceptLanguage: "", want: Es},
+		{acceptLanguage: "de;q=abc, it", want: It},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptLanguage, func(t *testing.T) {
+			assert.Equal(t, tt.want, NegotiateMagicLinkLanguage(tt.acceptLanguage, Es))
+		})
+	}
+}
+
+func TestMagicLinkOptionsAcceptLanguage(t *testing.T) {
+	auth, _, last := newMagicLinkTestAuth(t)
+
+	_, err := auth.CreateMagicLinkWithEmail("a@example.com", LoginType, true, &MagicLinkOptions{
+		AcceptLanguage: "pt-BR,pt;q=0.9",
+		Language:       En,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Pt, last.Language)
+
+	_, err = auth.CreateMagicLinkWithEmail("a@example.com", LoginType, true, &MagicLinkOptions{
+		AcceptLanguage: "fr-FR",
+		Language:       De,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, De, last.Language)
+}
@@ -0,0 +1,156 @@
+package passage
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MinMagicLinkTTL and MaxMagicLinkTTL bound MagicLinkOptions.TTL and MagicLinkOptions.TTLDuration.
+const (
+	MinMagicLinkTTL = time.Minute
+	MaxMagicLinkTTL = 24 * time.Hour
+)
+
+// ErrRedirectNotAllowed is returned when a magic link's RedirectURL or MagicLinkPath is not in the Auth's
+// redirect allow-list.
+var ErrRedirectNotAllowed = errors.New("redirect is not allowed")
+
+// RedirectAllowList restricts where magic links may send users.
+type RedirectAllowList struct {
+	// Origins lists the origins, such as "https://app.example.com", an absolute RedirectURL may point to.
+	// Relative redirects are always on the app's own origin.
+	Origins []string
+	// Paths lists the path.Match patterns, such as "/dashboard" or "/invite/*", that RedirectURL and
+	// MagicLinkPath paths must match. Paths are not restricted when it is empty.
+	Paths []string
+}
+
+type redirectAllowList struct {
+	origins []string
+	paths   []string
+}
+
+// WithRedirectAllowList makes Auth reject magic links whose RedirectURL or MagicLinkPath is not allowed by
+// allowList, before any request is made to the Passage API.
+func WithRedirectAllowList(allowList RedirectAllowList) Option {
+	return func(cfg *config) error {
+		redirects := &redirectAllowList{}
+
+		for _, origin := range allowList.Origins {
+			u, err := url.Parse(origin)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" ||
+				strings.TrimSuffix(u.Path, "/") != "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+				return fmt.Errorf("origin %q must be a scheme and host such as \"https://app.example.com\".", origin)
+			}
+
+			redirects.origins = append(redirects.origins, strings.ToLower(u.Scheme+"://"+u.Host))
+		}
+
+		for _, pattern := range allowList.Paths {
+			if _, err := path.Match(pattern, "/"); err != nil || !strings.HasPrefix(pattern, "/") {
+				return fmt.Errorf("path pattern %q must be a valid pattern starting with \"/\".", pattern)
+			}
+
+			redirects.paths = append(redirects.paths, pattern)
+		}
+
+		cfg.redirects = redirects
+		return nil
+	}
+}
+
+func (r *redirectAllowList) checkRedirectURL(redirectURL string) error {
+	u, err := parseRedirect(redirectURL)
+	if err != nil {
+		return err
+	}
+
+	if u.IsAbs() {
+		origin := strings.ToLower(u.Scheme + "://" + u.Host)
+		if !slices.Contains(r.origins, origin) {
+			return fmt.Errorf("%w: origin %q of RedirectURL is not in the allow-list", ErrRedirectNotAllowed, origin)
+		}
+	}
+
+	return r.checkPath("RedirectURL", u.Path)
+}
+
+func (r *redirectAllowList) checkMagicLinkPath(magicLinkPath string) error {
+	u, err := parseRedirect(magicLinkPath)
+	if err != nil {
+		return err
+	}
+
+	if u.IsAbs() {
+		return fmt.Errorf("%w: MagicLinkPath must be a relative url", ErrRedirectNotAllowed)
+	}
+
+	return r.checkPath("MagicLinkPath", u.Path)
+}
+
+func (r *redirectAllowList) checkPath(field string, p string) error {
+	if len(r.paths) == 0 {
+		return nil
+	}
+
+	if p == "" {
+		p = "/"
+	}
+
+	for _, pattern := range r.paths {
+		if matched, _ := path.Match(pattern, p); matched {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: path %q of %s is not in the allow-list", ErrRedirectNotAllowed, p, field)
+}
+
+// parseRedirect parses a redirect target, rejecting forms browsers may resolve to another origin than it appears to
+// have, such as "//evil.example" or "/\evil.example", and paths that escape their prefix with "..".
+func parseRedirect(target string) (*url.URL, error) {
+	if strings.Contains(target, `\`) || strings.HasPrefix(target, "//") ||
+		strings.ContainsFunc(target, func(r rune) bool { return r < 0x20 || r == 0x7f }) {
+		return nil, fmt.Errorf("%w: %q is not a safe redirect", ErrRedirectNotAllowed, target)
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q is not a valid url", ErrRedirectNotAllowed, target)
+	}
+
+	if u.IsAbs() && ((u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil) {
+		return nil, fmt.Errorf("%w: %q is not a safe redirect", ErrRedirectNotAllowed, target)
+	}
+
+	if !u.IsAbs() && (u.Host != "" || u.Opaque != "" || (u.Path != "" && !strings.HasPrefix(u.Path, "/"))) {
+		return nil, fmt.Errorf("%w: relative redirect %q must start with \"/\"", ErrRedirectNotAllowed, target)
+	}
+
+	if slices.Contains(strings.Split(u.Path, "/"), "..") {
+		return nil, fmt.Errorf("%w: %q must not contain \"..\"", ErrRedirectNotAllowed, target)
+	}
+
+	return u, nil
+}
+
+func validateMagicLinkTTL(ttl time.Duration) error {
+	if ttl == 0 {
+		return nil
+	}
+
+	if ttl < MinMagicLinkTTL || ttl > MaxMagicLinkTTL {
+		return fmt.Errorf("TTL must be between %v and %v.", MinMagicLinkTTL, MaxMagicLinkTTL)
+	}
+
+	if ttl%time.Minute != 0 {
+		return errors.New("TTL must be a whole number of minutes.")
+	}
+
+	return nil
+}
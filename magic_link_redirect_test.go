@@ -0,0 +1,135 @@
+package passage
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMagicLinkTestAuth returns an Auth that creates magic links against a local server, along with the number of
+// requests it has received and the last request body.
+func newMagicLinkTestAuth(t *testing.T, opts ...Option) (*Auth, *atomic.Int32, *magicLinkArgs) {
+	t.Helper()
+
+	var requests atomic.Int32
+	var last magicLinkArgs
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&last))
+		writeJSON(t, w, http.StatusCreated, MagicLinkResponse{MagicLink: MagicLink{ID: "magic-link-1"}})
+	}))
+	t.Cleanup(server.Close)
+
+	cfg, err := newConfig(opts)
+	require.NoError(t, err)
+
+	client, err := NewClientWithResponses(server.URL, WithHTTPClient(newHTTPClient(cfg)))
+	require.NoError(t, err)
+
+	auth, _ := newTestAuth(t, opts...)
+	auth.client = client
+
+	return auth, &requests, &last
+}
+
+func TestMagicLinkTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    MagicLinkOptions
+		wantErr bool
+		minutes int
+	}{
+		{name: "default", minutes: 0},
+		{name: "minutes", opts: MagicLinkOptions{TTL: 60}, minutes: 60},
+		{name: "negative minutes", opts: MagicLinkOptions{TTL: -1}, wantErr: true},
+		{name: "duration", opts: MagicLinkOptions{TTLDuration: 15 * time.Minute}, minutes: 15},
+		{name: "max duration", opts: MagicLinkOptions{TTLDuration: 24 * time.Hour}, minutes: 24 * 60},
+		{name: "below min", opts: MagicLinkOptions{TTLDuration: 30 * time.Second}, wantErr: true},
+		{name: "partial minute", opts: MagicLinkOptions{TTLDuration: 90 * time.Second}, wantErr: true},
+		{name: "above max", opts: MagicLinkOptions{TTLDuration: 60 * time.Hour}, wantErr: true},
+		{name: "both", opts: MagicLinkOptions{TTL: 15, TTLDuration: 15 * time.Minute}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, requests, last := newMagicLinkTestAuth(t)
+
+			_, err := auth.CreateMagicLinkWithEmail("a@example.com", LoginType, false, &tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Equal(t, int32(0), requests.Load())
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.minutes, last.TTL)
+		})
+	}
+}
+
+func TestMagicLinkRedirectAllowList(t *testing.T) {
+	allowList := RedirectAllowList{
+		Origins: []string{"https://app.example.com"},
+		Paths:   []string{"/dashboard", "/invite/*"},
+	}
+
+	tests := []struct {
+		redirectURL   string
+		magicLinkPath string
+		allowed       bool
+	}{
+		{redirectURL: "https://app.example.com/dashboard", allowed: true},
+		{redirectURL: "https://APP.example.com/invite/abc?x=1", allowed: true},
+		{redirectURL: "/dashboard", allowed: true},
+		{magicLinkPath: "/invite/abc", allowed: true},
+		{redirectURL: "https://evil.example/dashboard"},
+		{redirectURL: "https://app.example.com.evil.example/dashboard"},
+		{redirectURL: "https://app.example.com/admin"},
+		{redirectURL: "https://user@app.example.com/dashboard"},
+		{redirectURL: "//evil.example/dashboard"},
+		{redirectURL: "/\\evil.example"},
+		{redirectURL: "javascript:alert(1)"},
+		{redirectURL: "/invite/../admin"},
+		{redirectURL: "dashboard"},
+		{magicLinkPath: "https://app.example.com/dashboard"},
+		{magicLinkPath: "/admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %s", tt.redirectURL, tt.magicLinkPath), func(t *testing.T) {
+			auth, requests, _ := newMagicLinkTestAuth(t, WithRedirectAllowList(allowList))
+
+			_, err := auth.CreateMagicLinkWithEmail("a@example.com", LoginType, false, &MagicLinkOptions{
+				RedirectURL:   tt.redirectURL,
+				MagicLinkPath: tt.magicLinkPath,
+			})
+			if tt.allowed {
+				assert.NoError(t, err)
+				assert.Equal(t, int32(1), requests.Load())
+			} else {
+				assert.ErrorIs(t, err, ErrRedirectNotAllowed)
+				assert.Equal(t, int32(0), requests.Load())
+			}
+		})
+	}
+}
+
+func TestWithRedirectAllowListValidatesEntries(t *testing.T) {
+	for _, allowList := range []RedirectAllowList{
+		{Origins: []string{"app.example.com"}},
+		{Origins: []string{"https://app.example.com/path"}},
+		{Origins: []string{"ftp://app.example.com"}},
+		{Paths: []string{"dashboard"}},
+		{Paths: []string{"/[invalid"}},
+	} {
+		_, err := newConfig([]Option{WithRedirectAllowList(allowList)})
+		assert.Error(t, err, allowList)
+	}
+}
@@ -0,0 +1,268 @@
+package passage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"text/template"
+)
+
+// MagicLinkMessage is a rendered magic link message ready to be delivered.
+type MagicLinkMessage struct {
+	Channel ChannelType
+	// To is the email address or E164-formatted phone number to deliver the message to.
+	To       string
+	Language MagicLinkLanguage
+	// Subject is the subject of an email. It is empty for phone messages.
+	Subject   string
+	Body      string
+	MagicLink MagicLink
+}
+
+// Sender delivers magic link messages through your own infrastructure.
+type Sender interface {
+	Send(ctx context.Context, message MagicLinkMessage) error
+}
+
+// MagicLinkTemplate holds text/template sources for a magic link message. Templates are executed with a
+// MagicLinkTemplateData.
+type MagicLinkTemplate struct {
+	Subject string
+	Body    string
+}
+
+// MagicLinkTemplateData is the data magic link templates are executed with. The magic link's fields, such as
+// {{.URL}} and {{.TTL}} (in minutes), are available directly.
+type MagicLinkTemplateData struct {
+	MagicLink
+	Channel  ChannelType
+	Language MagicLinkLanguage
+}
+
+// MagicLinkSenderOptions configures WithMagicLinkSender.
+type MagicLinkSenderOptions struct {
+	// Templates overrides the built-in templates per language. Messages in a language without a template use the
+	// English template.
+	Templates map[MagicLinkLanguage]MagicLinkTemplate
+}
+
+var defaultMagicLinkTemplates = map[MagicLinkLanguage]MagicLinkTemplate{
+	De: {
+		Subject: "Ihr Magic Link",
+		Body:    "Verwenden Sie diesen Link, um fortzufahren:\n\n{{.URL}}\n{{if .TTL}}\nDer Link läuft in {{.TTL}} Minuten ab.\n{{end}}",
+	},
+	En: {
+		Subject: "Your magic link",
+		Body:    "Use this link to continue:\n\n{{.URL}}\n{{if .TTL}}\nThe link expires in {{.TTL}} minutes.\n{{end}}",
+	},
+	Es: {
+		Subject: "Tu enlace mágico",
+		Body:    "Usa este enlace para continuar:\n\n{{.URL}}\n{{if .TTL}}\nEl enlace caduca en {{.TTL}} minutos.\n{{end}}",
+	},
+	It: {
+		Subject: "Il tuo magic link",
+		Body:    "Usa questo link per continuare:\n\n{{.URL}}\n{{if .TTL}}\nIl link scade tra {{.TTL}} minuti.\n{{end}}",
+	},
+	Pl: {
+		Subject: "Twój magiczny link",
+		Body:    "Użyj tego linku, aby kontynuować:\n\n{{.URL}}\n{{if .TTL}}\nLink wygaśnie za {{.TTL}} minut.\n{{end}}",
+	},
+	Pt: {
+		Subject: "Seu link mágico",
+		Body:    "Use este link para continuar:\n\n{{.URL}}\n{{if .TTL}}\nO link expira em {{.TTL}} minutos.\n{{end}}",
+	},
+	Zh: {
+		Subject: "您的魔法链接",
+		Body:    "请使用此链接继续：\n\n{{.URL}}\n{{if .TTL}}\n该链接将在 {{.TTL}} 分钟后过期。\n{{end}}",
+	},
+}
+
+type parsedMagicLinkTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+type magicLinkSender struct {
+	sender    Sender
+	templates map[MagicLinkLanguage]parsedMagicLinkTemplate
+}
+
+// WithMagicLinkSender enables Auth.SendMagicLink, which delivers magic links through sender instead of Passage.
+func WithMagicLinkSender(sender Sender, opts *MagicLinkSenderOptions) Option {
+	return func(cfg *config) error {
+		if sender == nil {
+			return errors.New("sender is required.")
+		}
+
+		sources := map[MagicLinkLanguage]MagicLinkTemplate{}
+		for language, source := range defaultMagicLinkTemplates {
+			sources[language] = source
+		}
+		if opts != nil {
+			for language, source := range opts.Templates {
+				if err := validateLanguage(language); err != nil {
+					return err
+				}
+				sources[language] = source
+			}
+		}
+
+		s := &magicLinkSender{
+			sender:    sender,
+			templates: map[MagicLinkLanguage]parsedMagicLinkTemplate{},
+		}
+		for language, source := range sources {
+			subject, err := template.New(string(language) + " subject").Parse(source.Subject)
+			if err != nil {
+				return fmt.Errorf("invalid %s subject template: %w", language, err)
+			}
+
+			body, err := template.New(string(language) + " body").Parse(source.Body)
+			if err != nil {
+				return fmt.Errorf("invalid %s body template: %w", language, err)
+			}
+
+			s.templates[language] = parsedMagicLinkTemplate{subject: subject, body: body}
+		}
+
+		cfg.sender = s
+		return nil
+	}
+}
+
+func (s *magicLinkSender) render(channel ChannelType, to string, language MagicLinkLanguage, link MagicLink) (MagicLinkMessage, error) {
+	if language == "" {
+		language = En
+	}
+
+	tmpl, ok := s.templates[language]
+	if !ok {
+		tmpl = s.templates[En]
+	}
+
+	data := MagicLinkTemplateData{MagicLink: link, Channel: channel, Language: language}
+	message := MagicLinkMessage{Channel: channel, To: to, Language: language, MagicLink: link}
+
+	var body bytes.Buffer
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return MagicLinkMessage{}, fmt.Errorf("failed to render magic link message: %w", err)
+	}
+	message.Body = body.String()
+
+	if channel == EmailChannel {
+		var subject bytes.Buffer
+		if err := tmpl.subject.Execute(&subject, data); err != nil {
+			return MagicLinkMessage{}, fmt.Errorf("failed to render magic link subject: %w", err)
+		}
+		message.Subject = subject.String()
+	}
+
+	return message, nil
+}
+
+// MagicLinkRecipient identifies who SendMagicLink delivers a magic link to. Exactly one of Email, Phone and
+// UserID must be set; Channel is required with UserID.
+type MagicLinkRecipient struct {
+	Email   string
+	Phone   string
+	UserID  string
+	Channel ChannelType
+}
+
+// SendMagicLink creates a magic link without sending it from Passage, renders it with the template for the
+// language chosen by opts and delivers it with the Sender configured by WithMagicLinkSender. If delivery fails, the created
+// magic link is returned along with the error.
+func (a *Auth) SendMagicLink(
+	ctx context.Context,
+	recipient MagicLinkRecipient,
+	magicLinkType MagicLinkType,
+	opts *MagicLinkOptions,
+) (*MagicLink, error) {
+	if err := a.checkDryRun(ctx); err != nil {
+		return nil, err
+	}
+
+	if a.sender == nil {
+		return nil, errors.New("no magic link sender is configured, use WithMagicLinkSender.")
+	}
+
+	args, err := recipient.magicLinkArgs(magicLinkType)
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := a.createMagicLink(ctx, args, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := a.recipientAddress(ctx, recipient, link)
+	if err != nil {
+		return link, err
+	}
+
+	message, err := a.sender.render(args.ChannelType, to, opts.language(), *link)
+	if err != nil {
+		return link, err
+	}
+
+	if err := a.sender.sender.Send(ctx, message); err != nil {
+		return link, fmt.Errorf("failed to send magic link: %w", err)
+	}
+
+	return link, nil
+}
+
+func (r MagicLinkRecipient) magicLinkArgs(magicLinkType MagicLinkType) (magicLinkArgs, error) {
+	args := magicLinkArgs{Type: magicLinkType}
+	set := 0
+	if r.Email != "" {
+		set++
+		args.Email, args.ChannelType = r.Email, EmailChannel
+	}
+	if r.Phone != "" {
+		set++
+		args.Phone, args.ChannelType = r.Phone, PhoneChannel
+	}
+	if r.UserID != "" {
+		set++
+		args.UserID, args.ChannelType = r.UserID, r.Channel
+		if r.Channel != EmailChannel && r.Channel != PhoneChannel {
+			return magicLinkArgs{}, errors.New("recipient Channel must be email or phone.")
+		}
+	}
+	if set != 1 {
+		return magicLinkArgs{}, errors.New("exactly one of recipient Email, Phone and UserID is required.")
+	}
+
+	return args, nil
+}
+
+func (a *Auth) recipientAddress(ctx context.Context, recipient MagicLinkRecipient, link *MagicLink) (string, error) {
+	switch {
+	case recipient.Email != "":
+		return recipient.Email, nil
+	case recipient.Phone != "":
+		return recipient.Phone, nil
+	case link.Identifier != "":
+		return link.Identifier, nil
+	case a.user == nil:
+		return "", fmt.Errorf("failed to find address of user %q", recipient.UserID)
+	}
+
+	user, err := a.user.get(ctx, recipient.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	address := user.Email
+	if recipient.Channel == PhoneChannel {
+		address = user.Phone
+	}
+	if address == "" {
+		return "", fmt.Errorf("user %q has no %s", recipient.UserID, recipient.Channel)
+	}
+
+	return address, nil
+}
@@ -0,0 +1,333 @@
+package passage
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smtpMessage is a message received by a fakeSMTP server.
+type smtpMessage struct {
+	from      string
+	to        []string
+	data      []byte
+	encrypted bool
+}
+
+// fakeSMTP is a minimal local SMTP server that accepts every message. It offers STARTTLS when it has a TLS config.
+type fakeSMTP struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	messages  chan smtpMessage
+	wg        sync.WaitGroup
+}
+
+// newFakeSMTP starts a fakeSMTP server. With tls, it offers STARTTLS and the returned config trusts its certificate.
+func newFakeSMTP(t *testing.T, withTLS bool) (*fakeSMTP, *tls.Config) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &fakeSMTP{listener: listener, messages: make(chan smtpMessage, 10)}
+
+	var clientConfig *tls.Config
+	if withTLS {
+		// borrow httptest's certificate, which is valid for 127.0.0.1
+		tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+		tlsServer.Close()
+
+		s.tlsConfig = &tls.Config{Certificates: tlsServer.TLS.Certificates}
+		roots := x509.NewCertPool()
+		roots.AddCert(tlsServer.Certificate())
+		clientConfig = &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+
+	t.Cleanup(func() {
+		listener.Close()
+		s.wg.Wait()
+	})
+
+	return s, clientConfig
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	text := textproto.NewConn(conn)
+	defer func() { text.Close() }()
+
+	var message smtpMessage
+	_ = text.PrintfLine("220 localhost ready")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO":
+			_ = text.PrintfLine("250-localhost")
+			if s.tlsConfig != nil && !message.encrypted {
+				_ = text.PrintfLine("250-STARTTLS")
+			}
+			_ = text.PrintfLine("250 8BITMIME")
+		case "STARTTLS":
+			_ = text.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			text = textproto.NewConn(tlsConn)
+			message.encrypted = true
+		case "MAIL":
+			message.from = strings.Trim(strings.Fields(line[len("MAIL FROM:"):])[0], "<>")
+			_ = text.PrintfLine("250 OK")
+		case "RCPT":
+			message.to = append(message.to, strings.Trim(strings.Fields(line[len("RCPT TO:"):])[0], "<>"))
+			_ = text.PrintfLine("250 OK")
+		case "DATA":
+			_ = text.PrintfLine("354 go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			message.data = data
+			s.messages <- message
+			message = smtpMessage{encrypted: message.encrypted}
+			_ = text.PrintfLine("250 OK")
+		case "QUIT":
+			_ = text.PrintfLine("221 bye")
+			return
+		default:
+			_ = text.PrintfLine("250 OK")
+		}
+	}
+}
+
+func newSenderTestAuth(t *testing.T, sender Sender, opts *MagicLinkSenderOptions) (*Auth, *magicLinkArgs) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var last magicLinkArgs
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&last))
+		identifier := last.Email + last.Phone
+		if last.UserID != "" {
+			identifier = "user@example.com"
+		}
+		writeJSON(t, w, http.StatusCreated, MagicLinkResponse{MagicLink: MagicLink{
+			ID:         "magic-link-1",
+			Identifier: identifier,
+			TTL:        15,
+			URL:        "https://app.example.com/magic?token=abc",
+		}})
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClientWithResponses(server.URL)
+	require.NoError(t, err)
+
+	auth, _ := newTestAuth(t, WithMagicLinkSender(sender, opts))
+	auth.client = client
+
+	return auth, &last
+}
+
+func TestSendMagicLinkWithSMTP(t *testing.T) {
+	smtpServer, tlsConfig := newFakeSMTP(t, true)
+	sender, err := NewSMTPSender(SMTPSenderOptions{
+		Addr:      smtpServer.listener.Addr().String(),
+		From:      "Example <no-reply@example.com>",
+		TLSConfig: tlsConfig,
+	})
+	require.NoError(t, err)
+
+	auth, args := newSenderTestAuth(t, sender, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	link, err := auth.SendMagicLink(ctx, MagicLinkRecipient{Email: "a@example.com"}, LoginType, &MagicLinkOptions{Language: De})
+	require.NoError(t, err)
+	assert.Equal(t, "magic-link-1", link.ID)
+	assert.False(t, args.Send)
+	assert.Equal(t, EmailChannel, args.ChannelType)
+
+	message := <-smtpServer.messages
+	assert.True(t, message.encrypted)
+	assert.Equal(t, "no-reply@example.com", message.from)
+	assert.Equal(t, []string{"a@example.com"}, message.to)
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(message.data)))
+	require.NoError(t, err)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Ihr Magic Link", subject)
+
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "https://app.example.com/magic?token=abc")
+	assert.Contains(t, string(body), "Der Link läuft in 15 Minuten ab.")
+}
+
+func TestSMTPSenderRequiresSTARTTLS(t *testing.T) {
+	smtpServer, _ := newFakeSMTP(t, false)
+	message := MagicLinkMessage{Channel: EmailChannel, To: "a@example.com", Subject: "Magic link", Body: "secret"}
+
+	sender, err := NewSMTPSender(SMTPSenderOptions{Addr: smtpServer.listener.Addr().String(), From: "no-reply@example.com"})
+	require.NoError(t, err)
+	assert.ErrorContains(t, sender.Send(context.Background(), message), "doesn't support STARTTLS")
+	assert.Empty(t, smtpServer.messages)
+
+	sender, err = NewSMTPSender(SMTPSenderOptions{
+		Addr:                   smtpServer.listener.Addr().String(),
+		From:                   "no-reply@example.com",
+		InsecureAllowPlaintext: true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, sender.Send(context.Background(), message))
+	assert.False(t, (<-smtpServer.messages).encrypted)
+}
+
+func TestSMTPSenderRejectsPhoneMessages(t *testing.T) {
+	sender, err := NewSMTPSender(SMTPSenderOptions{Addr: "127.0.0.1:25", From: "no-reply@example.com"})
+	require.NoError(t, err)
+
+	err = sender.Send(context.Background(), MagicLinkMessage{Channel: PhoneChannel, To: "+15005550006"})
+	assert.Error(t, err)
+}
+
+func TestSendMagicLinkWithHTTPSender(t *testing.T) {
+	received := make(chan httpSenderPayload, 1)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		handler, err := NewWebhookHandler("sender-secret", nil)
+		require.NoError(t, err)
+		assert.NoError(t, handler.verify(r.Header.Get(WebhookSignatureHeader), body))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+
+		var payload httpSenderPayload
+		require.NoError(t, json.Unmarshal(body, &payload))
+		received <- payload
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(endpoint.Close)
+
+	sender, err := NewHTTPSender(endpoint.URL, &HTTPSenderOptions{
+		Header: http.Header{"Authorization": {"Bearer token"}},
+		Secret: "sender-secret",
+	})
+	require.NoError(t, err)
+
+	auth, args := newSenderTestAuth(t, sender, &MagicLinkSenderOptions{
+		Templates: map[MagicLinkLanguage]MagicLinkTemplate{
+			En: {Body: "Sign in to Example: {{.URL}}"},
+		},
+	})
+
+	_, err = auth.SendMagicLink(context.Background(), MagicLinkRecipient{UserID: "user-1", Channel: PhoneChannel}, LoginType, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", args.UserID)
+
+	payload := <-received
+	assert.Equal(t, PhoneChannel, payload.Channel)
+	assert.Equal(t, "user@example.com", payload.To)
+	assert.Equal(t, En, payload.Language)
+	assert.Empty(t, payload.Subject)
+	assert.Equal(t, "Sign in to Example: https://app.example.com/magic?token=abc", payload.Body)
+}
+
+func TestSendMagicLinkReturnsLinkWhenDeliveryFails(t *testing.T) {
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(endpoint.Close)
+
+	sender, err := NewHTTPSender(endpoint.URL, nil)
+	require.NoError(t, err)
+
+	auth, _ := newSenderTestAuth(t, sender, nil)
+
+	link, err := auth.SendMagicLink(context.Background(), MagicLinkRecipient{Email: "a@example.com"}, LoginType, nil)
+	assert.ErrorContains(t, err, "503")
+	require.NotNil(t, link)
+	assert.Equal(t, "magic-link-1", link.ID)
+}
+
+func TestHTTPSenderDefaultsToClientWithTimeout(t *testing.T) {
+	sender, err := NewHTTPSender("http://127.0.0.1:1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, defaultHTTPSenderTimeout, sender.client.Timeout)
+
+	client := &http.Client{}
+	sender, err = NewHTTPSender("http://127.0.0.1:1", &HTTPSenderOptions{Client: client})
+	require.NoError(t, err)
+	assert.Same(t, client, sender.client)
+}
+
+func TestSendMagicLinkValidatesRecipient(t *testing.T) {
+	sender, err := NewHTTPSender("http://127.0.0.1:1", nil)
+	require.NoError(t, err)
+
+	auth, _ := newSenderTestAuth(t, sender, nil)
+
+	for _, recipient := range []MagicLinkRecipient{
+		{},
+		{Email: "a@example.com", Phone: "+15005550006"},
+		{UserID: "user-1"},
+	} {
+		_, err := auth.SendMagicLink(context.Background(), recipient, LoginType, nil)
+		assert.Error(t, err, recipient)
+	}
+}
+
+func TestWithMagicLinkSenderValidatesTemplates(t *testing.T) {
+	sender, err := NewHTTPSender("http://127.0.0.1:1", nil)
+	require.NoError(t, err)
+
+	_, err = newConfig([]Option{WithMagicLinkSender(sender, &MagicLinkSenderOptions{
+		Templates: map[MagicLinkLanguage]MagicLinkTemplate{En: {Body: "{{.URL"}},
+	})})
+	assert.Error(t, err)
+
+	_, err = newConfig([]Option{WithMagicLinkSender(sender, &MagicLinkSenderOptions{
+		Templates: map[MagicLinkLanguage]MagicLinkTemplate{"fr": {Body: "{{.URL}}"}},
+	})})
+	assert.Error(t, err)
+}
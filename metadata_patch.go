@@ -0,0 +1,338 @@
+package passage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// MetadataPatch describes a partial change to a user's metadata. It is implemented by MergePatch and JSONPatch.
+type MetadataPatch interface {
+	apply(metadata map[string]interface{}) (map[string]interface{}, error)
+}
+
+// MergePatch is an RFC 7396 JSON Merge Patch. Nested objects are merged recursively
+// and keys set to nil are removed.
+type MergePatch map[string]interface{}
+
+// JSONPatch is an RFC 6902 JSON Patch document whose paths are relative to the user metadata object.
+type JSONPatch []JSONPatchOperation
+
+// JSONPatchOperation is a single RFC 6902 operation.
+type JSONPatchOperation struct {
+	// Op is one of "add", "remove", "replace", "move", "copy" or "test".
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+func (p MergePatch) apply(metadata map[string]interface{}) (map[string]interface{}, error) {
+	var patch map[string]interface{}
+	if err := normalizeJSON(map[string]interface{}(p), &patch); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+
+	result, _ := mergePatch(metadata, patch).(map[string]interface{})
+	return result, nil
+}
+
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok || targetObject == nil {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatch(targetObject[key], value)
+		}
+	}
+
+	return targetObject
+}
+
+func (p JSONPatch) apply(metadata map[string]interface{}) (map[string]interface{}, error) {
+	var doc interface{} = metadata
+	if metadata == nil {
+		doc = map[string]interface{}{}
+	}
+
+	for i, op := range p {
+		var err error
+		doc, err = op.apply(doc)
+		if err != nil {
+			return nil, fmt.Errorf("json patch operation %d (%s %q): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	result, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("json patch must leave user metadata as an object")
+	}
+
+	return result, nil
+}
+
+func (op JSONPatchOperation) apply(doc interface{}) (interface{}, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		var value interface{}
+		if err := normalizeJSON(op.Value, &value); err != nil {
+			return nil, fmt.Errorf("invalid value: %w", err)
+		}
+
+		switch op.Op {
+		case "add":
+			return addAt(doc, path, value)
+		case "replace":
+			return replaceAt(doc, path, value)
+		default:
+			current, err := getAt(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, errors.New("test failed")
+			}
+			return doc, nil
+		}
+	case "remove":
+		return removeAt(doc, path)
+	case "move", "copy":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from: %w", err)
+		}
+
+		value, err := getAt(doc, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "copy" {
+			if err := normalizeJSON(value, &value); err != nil {
+				return nil, err
+			}
+			return addAt(doc, path, value)
+		}
+
+		if len(path) > len(from) && hasPathPrefix(path, from) {
+			return nil, errors.New("cannot move a value into one of its children")
+		}
+
+		doc, err = removeAt(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return addAt(doc, path, value)
+	default:
+		return nil, fmt.Errorf("unsupported op %q", op.Op)
+	}
+}
+
+var jsonPointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// parseJSONPointer splits an RFC 6901 JSON Pointer into its unescaped reference tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = jsonPointerUnescaper.Replace(token)
+	}
+
+	return tokens, nil
+}
+
+func getAt(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		var err error
+		doc, err = childOf(doc, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+func addAt(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return updateParent(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch parent := parent.(type) {
+		case map[string]interface{}:
+			parent[token] = value
+			return parent, nil
+		case []interface{}:
+			if token == "-" {
+				return append(parent, value), nil
+			}
+
+			index, err := arrayIndex(token, len(parent)+1)
+			if err != nil {
+				return nil, err
+			}
+
+			parent = append(parent, nil)
+			copy(parent[index+1:], parent[index:])
+			parent[index] = value
+			return parent, nil
+		default:
+			return nil, fmt.Errorf("cannot add %q to a non-container value", token)
+		}
+	})
+}
+
+func replaceAt(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return updateParent(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		if _, err := childOf(parent, token); err != nil {
+			return nil, err
+		}
+
+		return setChild(parent, token, value)
+	})
+}
+
+func removeAt(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, errors.New("cannot remove the user metadata object")
+	}
+
+	return updateParent(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch parent := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := parent[token]; !ok {
+				return nil, fmt.Errorf("path member %q does not exist", token)
+			}
+			delete(parent, token)
+			return parent, nil
+		case []interface{}:
+			index, err := arrayIndex(token, len(parent))
+			if err != nil {
+				return nil, err
+			}
+			return append(parent[:index], parent[index+1:]...), nil
+		default:
+			return nil, fmt.Errorf("cannot remove %q from a non-container value", token)
+		}
+	})
+}
+
+// updateParent walks to the parent of the location identified by path, replaces it with the result of fn
+// and writes the new parent back into its own container, since appending to a slice may reallocate it.
+func updateParent(
+	doc interface{},
+	path []string,
+	fn func(parent interface{}, token string) (interface{}, error),
+) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	child, err := childOf(doc, path[0])
+	if err != nil {
+		return nil, err
+	}
+
+	child, err = updateParent(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	return setChild(doc, path[0], child)
+}
+
+func childOf(doc interface{}, token string) (interface{}, error) {
+	switch doc := doc.(type) {
+	case map[string]interface{}:
+		child, ok := doc[token]
+		if !ok {
+			return nil, fmt.Errorf("path member %q does not exist", token)
+		}
+		return child, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(doc))
+		if err != nil {
+			return nil, err
+		}
+		return doc[index], nil
+	default:
+		return nil, fmt.Errorf("cannot reference %q in a non-container value", token)
+	}
+}
+
+func setChild(doc interface{}, token string, value interface{}) (interface{}, error) {
+	switch doc := doc.(type) {
+	case map[string]interface{}:
+		doc[token] = value
+		return doc, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(doc))
+		if err != nil {
+			return nil, err
+		}
+		doc[index] = value
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("cannot set %q in a non-container value", token)
+	}
+}
+
+func arrayIndex(token string, length int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index >= length || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	return index, nil
+}
+
+func hasPathPrefix(path []string, prefix []string) bool {
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// normalizeJSON round-trips v through encoding/json so that it only contains the types produced by
+// decoding JSON, which also makes dst an independent deep copy of v.
+func normalizeJSON(v interface{}, dst interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(raw, dst)
+}
@@ -0,0 +1,111 @@
+package passage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePatch(t *testing.T) {
+	metadata := map[string]interface{}{
+		"plan":  "pro",
+		"prefs": map[string]interface{}{"theme": "dark", "lang": "en"},
+		"beta":  true,
+	}
+
+	patched, err := MergePatch{
+		"prefs": map[string]interface{}{"theme": nil, "tz": "UTC"},
+		"beta":  nil,
+		"seats": 3,
+	}.apply(metadata)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"plan":  "pro",
+		"prefs": map[string]interface{}{"lang": "en", "tz": "UTC"},
+		"seats": float64(3),
+	}, patched)
+}
+
+func TestJSONPatch(t *testing.T) {
+	metadata := map[string]interface{}{
+		"plan": "pro",
+		"tags": []interface{}{"a", "c"},
+		"a/b":  "escaped",
+	}
+
+	patched, err := JSONPatch{
+		{Op: "test", Path: "/plan", Value: "pro"},
+		{Op: "add", Path: "/tags/1", Value: "b"},
+		{Op: "add", Path: "/tags/-", Value: "d"},
+		{Op: "replace", Path: "/plan", Value: "team"},
+		{Op: "move", From: "/a~1b", Path: "/moved"},
+		{Op: "copy", From: "/plan", Path: "/previous_plan"},
+		{Op: "remove", Path: "/tags/0"},
+	}.apply(metadata)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"plan":          "team",
+		"previous_plan": "team",
+		"tags":          []interface{}{"b", "c", "d"},
+		"moved":         "escaped",
+	}, patched)
+}
+
+func TestJSONPatchErrors(t *testing.T) {
+	tests := map[string]JSONPatch{
+		"failed test":      {{Op: "test", Path: "/plan", Value: "free"}},
+		"missing member":   {{Op: "remove", Path: "/missing"}},
+		"bad index":        {{Op: "replace", Path: "/tags/01", Value: "x"}},
+		"bad pointer":      {{Op: "add", Path: "plan", Value: "x"}},
+		"unsupported op":   {{Op: "increment", Path: "/plan"}},
+		"non-object root":  {{Op: "replace", Path: "", Value: []interface{}{}}},
+		"move into itself": {{Op: "move", From: "/tags", Path: "/tags/0"}},
+	}
+
+	for name, patch := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := patch.apply(map[string]interface{}{"plan": "pro", "tags": []interface{}{"a"}})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPatchMetadataReadsOnceAndWrites(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	stored := PassageUser{
+		ID:           "user-1",
+		UpdatedAt:    time.Unix(100, 0).UTC(),
+		UserMetadata: map[string]interface{}{"plan": "pro", "seats": 10},
+	}
+
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests[r.Method]++
+		if r.Method == http.MethodPatch {
+			var body struct {
+				UserMetadata map[string]interface{} `json:"user_metadata"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			stored.UserMetadata = body.UserMetadata
+			stored.UpdatedAt = stored.UpdatedAt.Add(time.Second)
+		}
+
+		writeJSON(t, w, http.StatusOK, UserResponse{PassageUser: stored})
+	}))
+
+	user, err := u.PatchMetadata(context.Background(), "user-1", MergePatch{"plan": "team"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"plan": "team", "seats": float64(10)}, user.UserMetadata)
+	assert.Equal(t, map[string]int{http.MethodGet: 1, http.MethodPatch: 1}, requests)
+}
@@ -0,0 +1,71 @@
+package passage
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Operation identifies a Passage API operation, for configuring behavior such as rate limits per operation.
+type Operation string
+
+const (
+	OperationCreateMagicLink         Operation = "CreateMagicLink"
+	OperationListPaginatedUsers      Operation = "ListPaginatedUsers"
+	OperationCreateUser              Operation = "CreateUser"
+	OperationGetUser                 Operation = "GetUser"
+	OperationUpdateUser              Operation = "UpdateUser"
+	OperationDeleteUser              Operation = "DeleteUser"
+	OperationActivateUser            Operation = "ActivateUser"
+	OperationDeactivateUser          Operation = "DeactivateUser"
+	OperationListUserDevices         Operation = "ListUserDevices"
+	OperationDeleteUserDevices       Operation = "DeleteUserDevices"
+	OperationRevokeUserRefreshTokens Operation = "RevokeUserRefreshTokens"
+)
+
+// operationOf returns the operation a request made by the generated client is for, or "" if it is not recognized.
+func operationOf(req *http.Request) Operation {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+
+	// skip any base path such as "/v1" and the app ID
+	i := 0
+	for i < len(segments) && segments[i] != "apps" {
+		i++
+	}
+	if i+2 > len(segments) {
+		return ""
+	}
+	segments = segments[i+2:]
+
+	switch {
+	case len(segments) == 1 && segments[0] == "magic-links" && req.Method == http.MethodPost:
+		return OperationCreateMagicLink
+	case len(segments) == 1 && segments[0] == "users" && req.Method == http.MethodGet:
+		return OperationListPaginatedUsers
+	case len(segments) == 1 && segments[0] == "users" && req.Method == http.MethodPost:
+		return OperationCreateUser
+	case len(segments) == 2 && segments[0] == "users":
+		switch req.Method {
+		case http.MethodGet:
+			return OperationGetUser
+		case http.MethodPatch:
+			return OperationUpdateUser
+		case http.MethodDelete:
+			return OperationDeleteUser
+		}
+	case len(segments) == 3 && segments[0] == "users":
+		switch {
+		case segments[2] == "activate" && req.Method == http.MethodPatch:
+			return OperationActivateUser
+		case segments[2] == "deactivate" && req.Method == http.MethodPatch:
+			return OperationDeactivateUser
+		case segments[2] == "devices" && req.Method == http.MethodGet:
+			return OperationListUserDevices
+		case segments[2] == "tokens" && req.Method == http.MethodDelete:
+			return OperationRevokeUserRefreshTokens
+		}
+	case len(segments) == 4 && segments[0] == "users" && segments[2] == "devices" && req.Method == http.MethodDelete:
+		return OperationDeleteUserDevices
+	}
+
+	return ""
+}
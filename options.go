@@ -0,0 +1,50 @@
+package passage
+
+import (
+	"errors"
+)
+
+// Option configures optional behavior of a Passage instance created with New.
+type Option func(*config) error
+
+type config struct {
+	userCache       *userCache
+	revocations     RevocationStore
+	userStatusCheck *UserStatusCheckOptions
+	redirects       *redirectAllowList
+	sender          *magicLinkSender
+	rateLimiter     *rateLimiter
+	breaker         *circuitBreaker
+	retry           *RetryOptions
+	deduper         *deduper
+	dryRun          func(UserChange)
+	http            HTTPOptions
+	credentials     CredentialsProvider
+	metadataRules   *MetadataRules
+	// jwksURL overrides where the app's JWKS is fetched from. Only tests set it, with withJWKSURL.
+	jwksURL string
+}
+
+func newConfig(opts []Option) (config, error) {
+	var cfg config
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return config{}, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// WithUserCache caches the results of User.Get and User.GetByIdentifier in cache. Entries are invalidated when
+// the same Passage instance updates, activates, deactivates or deletes a user or revokes one of their devices.
+func WithUserCache(cache Cache, opts *UserCacheOptions) Option {
+	return func(cfg *config) error {
+		if cache == nil {
+			return errors.New("cache is required.")
+		}
+
+		cfg.userCache = newUserCache(cache, opts)
+		return nil
+	}
+}
@@ -11,37 +11,51 @@ import (
 type Passage struct {
 	Auth *Auth
 	User *User
+
+	rateLimiter *rateLimiter
+	breaker     *circuitBreaker
 }
 
-// New creates a new Passage instance.
-func New(appID string, apiKey string) (*Passage, error) {
+// New creates a new Passage instance. Optional behavior can be enabled with opts.
+func New(appID string, apiKey string, opts ...Option) (*Passage, error) {
 	if appID == "" {
 		return nil, errors.New("A Passage App ID is required. Please include (YOUR_APP_ID, YOUR_API_KEY).")
 	}
 
-	if apiKey == "" {
-		return nil, errors.New("A Passage API key is required. Please include (YOUR_APP_ID, YOUR_API_KEY).")
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.credentials == nil {
+		if apiKey == "" {
+			return nil, errors.New("A Passage API key is required. Please include (YOUR_APP_ID, YOUR_API_KEY).")
+		}
+
+		cfg.credentials = StaticCredentials(apiKey, "")
 	}
 
 	client, err := NewClientWithResponses(
 		"https://api.passage.id/v1/",
+		WithHTTPClient(newHTTPClient(cfg)),
 		withPassageVersion(),
-		withAPIKey(apiKey),
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	auth, err := newAuth(appID, client)
+	user := newUser(appID, client, cfg)
+
+	auth, err := newAuth(appID, client, user, cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	user := newUser(appID, client)
-
 	return &Passage{
-		User: user,
-		Auth: auth,
+		User:        user,
+		Auth:        auth,
+		rateLimiter: cfg.rateLimiter,
+		breaker:     cfg.breaker,
 	}, nil
 }
 
@@ -51,12 +65,3 @@ func withPassageVersion() ClientOption {
 		return nil
 	})
 }
-
-func withAPIKey(apiKey string) ClientOption {
-	return WithRequestEditorFn(func(_ context.Context, req *http.Request) error {
-		if apiKey != "" {
-			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
-		}
-		return nil
-	})
-}
@@ -2,7 +2,10 @@ package passage
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"slices"
 	"strings"
 )
 
@@ -10,6 +13,8 @@ type PassageError struct {
 	Message    string
 	ErrorCode  string
 	StatusCode int
+	// RequestID identifies the request to Passage support.
+	RequestID string
 }
 
 func (e PassageError) Error() string {
@@ -28,10 +33,14 @@ func (e PassageError) Error() string {
 		sb.WriteString(fmt.Sprintf("statusCode: %v, ", e.StatusCode))
 	}
 
+	if e.RequestID != "" {
+		sb.WriteString(fmt.Sprintf("requestID: %s, ", e.RequestID))
+	}
+
 	return strings.TrimSuffix(sb.String(), ", ")
 }
 
-func errorFromResponse(body []byte, statusCode int) error {
+func errorFromResponse(res *http.Response, body []byte) error {
 	var errorBody struct {
 		Code  string `json:"code"`
 		Error string `json:"error"`
@@ -43,6 +52,24 @@ func errorFromResponse(body []byte, statusCode int) error {
 	return PassageError{
 		Message:    errorBody.Error,
 		ErrorCode:  errorBody.Code,
-		StatusCode: statusCode,
+		StatusCode: res.StatusCode,
+		RequestID:  requestIDOf(res.Header),
 	}
 }
+
+var userExistsErrorCodes = []string{"user_already_exists", "identifier_already_exists", "identifier_exists"}
+
+// isUserExistsError reports whether err is the API's response to creating a user whose identifier is taken.
+func isUserExistsError(err error) bool {
+	var passageErr PassageError
+	if !errors.As(err, &passageErr) {
+		return false
+	}
+
+	return passageErr.StatusCode == http.StatusConflict || slices.Contains(userExistsErrorCodes, passageErr.ErrorCode)
+}
+
+func isNotFoundError(err error) bool {
+	var passageErr PassageError
+	return errors.As(err, &passageErr) && passageErr.StatusCode == http.StatusNotFound
+}
@@ -24,3 +24,12 @@ func TestPassageErrorWithOnlyMessage(t *testing.T) {
 	}
 	assert.Equal(t, fmt.Sprintf("PassageError - message: %s", err.Message), err.Error())
 }
+
+func TestPassageErrorWithRequestID(t *testing.T) {
+	err := passage.PassageError{
+		Message:    "some message",
+		StatusCode: http.StatusInternalServerError,
+		RequestID:  "req-123",
+	}
+	assert.Equal(t, fmt.Sprintf("PassageError - message: %s, statusCode: %d, requestID: %s", err.Message, err.StatusCode, err.RequestID), err.Error())
+}
@@ -0,0 +1,188 @@
+package passage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultRevocationRetention = 24 * time.Hour
+
+// ErrTokenRevoked is returned by ValidateJWT when the token was issued before its user's tokens were revoked.
+var ErrTokenRevoked = errors.New("jwt has been revoked")
+
+// ErrRevocationNotRecorded is returned, wrapped with the store's error, when a user operation succeeded but the
+// revocation of the user's access tokens could not be recorded in the RevocationStore. Their existing tokens are
+// still accepted by ValidateJWT.
+var ErrRevocationNotRecorded = errors.New("the user operation succeeded but the revocation of access tokens was not recorded")
+
+// RevocationStore records, per user, the time before which their access tokens are no longer accepted.
+// Implementations must be safe for concurrent use.
+type RevocationStore interface {
+	// Revoke rejects every token issued to userID at or before before.
+	Revoke(ctx context.Context, userID string, before time.Time) error
+	// RevokedBefore returns the time set by the latest Revoke for userID and whether there is one.
+	RevokedBefore(ctx context.Context, userID string) (time.Time, bool, error)
+}
+
+// RevocationStoreOptions configures the revocation stores provided by this package.
+type RevocationStoreOptions struct {
+	// Retention is how long a revocation is kept. It should be at least as long as your app's access token
+	// lifetime, since tokens issued before a revocation that has been forgotten are accepted again.
+	// Defaults to 24 hours.
+	Retention time.Duration
+}
+
+func revocationRetention(opts *RevocationStoreOptions) time.Duration {
+	if opts != nil && opts.Retention > 0 {
+		return opts.Retention
+	}
+
+	return defaultRevocationRetention
+}
+
+// MemoryRevocationStore is a RevocationStore local to the process.
+type MemoryRevocationStore struct {
+	retention time.Duration
+	now       func() time.Time
+
+	mu          sync.Mutex
+	revocations map[string]time.Time
+}
+
+// NewMemoryRevocationStore creates a MemoryRevocationStore.
+func NewMemoryRevocationStore(opts *RevocationStoreOptions) *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		retention:   revocationRetention(opts),
+		now:         time.Now,
+		revocations: map[string]time.Time{},
+	}
+}
+
+// Revoke implements RevocationStore.
+func (s *MemoryRevocationStore) Revoke(_ context.Context, userID string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune()
+	if current, ok := s.revocations[userID]; !ok || before.After(current) {
+		s.revocations[userID] = before
+	}
+
+	return nil
+}
+
+// RevokedBefore implements RevocationStore.
+func (s *MemoryRevocationStore) RevokedBefore(_ context.Context, userID string) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, ok := s.revocations[userID]
+	if !ok || s.expired(before) {
+		return time.Time{}, false, nil
+	}
+
+	return before, true, nil
+}
+
+func (s *MemoryRevocationStore) expired(before time.Time) bool {
+	return s.now().Sub(before) > s.retention
+}
+
+func (s *MemoryRevocationStore) prune() {
+	for userID, before := range s.revocations {
+		if s.expired(before) {
+			delete(s.revocations, userID)
+		}
+	}
+}
+
+// SharedRevocationStore is a RevocationStore kept in a Cache, such as RedisCache, so revocations made by one
+// process are enforced by every process sharing the cache.
+type SharedRevocationStore struct {
+	cache     Cache
+	retention time.Duration
+}
+
+// NewSharedRevocationStore creates a SharedRevocationStore backed by cache.
+func NewSharedRevocationStore(cache Cache, opts *RevocationStoreOptions) *SharedRevocationStore {
+	return &SharedRevocationStore{
+		cache:     cache,
+		retention: revocationRetention(opts),
+	}
+}
+
+func revocationKey(userID string) string {
+	return "passage:revoked:" + userID
+}
+
+// Revoke implements RevocationStore.
+func (s *SharedRevocationStore) Revoke(ctx context.Context, userID string, before time.Time) error {
+	value := strconv.FormatInt(before.UnixNano(), 10)
+	return s.cache.Set(ctx, revocationKey(userID), []byte(value), s.retention)
+}
+
+// RevokedBefore implements RevocationStore.
+func (s *SharedRevocationStore) RevokedBefore(ctx context.Context, userID string) (time.Time, bool, error) {
+	value, ok, err := s.cache.Get(ctx, revocationKey(userID))
+	if err != nil || !ok {
+		return time.Time{}, false, err
+	}
+
+	nanos, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid revocation for user %q: %w", userID, err)
+	}
+
+	return time.Unix(0, nanos), true, nil
+}
+
+// WithRevocationStore makes Auth.ValidateJWT reject access tokens issued before their user's tokens were revoked.
+// Revocations are recorded automatically when User.RevokeRefreshTokens, User.Deactivate or User.Delete succeed.
+func WithRevocationStore(store RevocationStore) Option {
+	return func(cfg *config) error {
+		if store == nil {
+			return errors.New("store is required.")
+		}
+
+		cfg.revocations = store
+		return nil
+	}
+}
+
+// recordRevocation rejects the user's existing access tokens after an operation that ends their sessions. Its
+// error wraps ErrRevocationNotRecorded, since the operation itself has already succeeded.
+func (u *User) recordRevocation(ctx context.Context, userID string) error {
+	if u.revocations == nil {
+		return nil
+	}
+
+	if err := u.revocations.Revoke(ctx, userID, time.Now()); err != nil {
+		return fmt.Errorf("user %q: %w: %w", userID, ErrRevocationNotRecorded, err)
+	}
+
+	return nil
+}
+
+// checkRevocation returns ErrTokenRevoked if a token issued to userID at issuedAt has been revoked.
+// Tokens without an iat claim are rejected once their user has any revocation.
+func (a *Auth) checkRevocation(ctx context.Context, userID string, issuedAt *time.Time) error {
+	if a.revocations == nil {
+		return nil
+	}
+
+	before, ok, err := a.revocations.RevokedBefore(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check revocation of jwt: %w", err)
+	}
+
+	// iat has a resolution of one second, so a token issued in the same second as a revocation is rejected
+	if ok && (issuedAt == nil || !issuedAt.After(before)) {
+		return ErrTokenRevoked
+	}
+
+	return nil
+}
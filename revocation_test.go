@@ -0,0 +1,101 @@
+package passage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateJWTRejectsRevokedTokens(t *testing.T) {
+	store := NewMemoryRevocationStore(nil)
+	auth, signer := newTestAuth(t, WithRevocationStore(store))
+
+	issuedAt := time.Now().Add(-time.Minute)
+	oldToken := signer.sign("user-1", issuedAt)
+
+	userID, err := auth.ValidateJWT(oldToken)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", userID)
+
+	require.NoError(t, store.Revoke(context.Background(), "user-1", issuedAt.Add(30*time.Second)))
+
+	_, err = auth.ValidateJWT(oldToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+
+	// tokens issued after the revocation, and tokens of other users, are still accepted
+	_, err = auth.ValidateJWT(signer.sign("user-1", time.Now()))
+	assert.NoError(t, err)
+
+	_, err = auth.ValidateJWT(signer.sign("user-2", issuedAt))
+	assert.NoError(t, err)
+}
+
+func TestUserOperationsRecordRevocations(t *testing.T) {
+	operations := map[string]func(u *User) error{
+		"revoke refresh tokens": func(u *User) error { return u.RevokeRefreshTokens("user-1") },
+		"deactivate":            func(u *User) error { _, err := u.Deactivate("user-1"); return err },
+		"delete":                func(u *User) error { return u.Delete("user-1") },
+	}
+
+	for name, operation := range operations {
+		t.Run(name, func(t *testing.T) {
+			store := NewSharedRevocationStore(NewRedisCache(newFakeRedis(), ""), nil)
+			u := newTestUser(t, newFakeAPI(t, PassageUser{ID: "user-1"}), WithRevocationStore(store))
+
+			before := time.Now()
+			require.NoError(t, operation(u))
+
+			revokedBefore, ok, err := store.RevokedBefore(context.Background(), "user-1")
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.False(t, revokedBefore.Before(before))
+		})
+	}
+}
+
+func TestMemoryRevocationStoreForgetsAfterRetention(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemoryRevocationStore(&RevocationStoreOptions{Retention: time.Hour})
+	store.now = func() time.Time { return now }
+
+	require.NoError(t, store.Revoke(context.Background(), "user-1", now))
+	// an older revocation doesn't replace a newer one
+	require.NoError(t, store.Revoke(context.Background(), "user-1", now.Add(-time.Minute)))
+
+	before, ok, err := store.RevokedBefore(context.Background(), "user-1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, now, before)
+
+	now = now.Add(2 * time.Hour)
+	_, ok, err = store.RevokedBefore(context.Background(), "user-1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+// failingRevocationStore is a RevocationStore that can't record revocations.
+type failingRevocationStore struct{}
+
+func (failingRevocationStore) Revoke(context.Context, string, time.Time) error {
+	return errors.New("store unavailable")
+}
+
+func (failingRevocationStore) RevokedBefore(context.Context, string) (time.Time, bool, error) {
+	return time.Time{}, false, nil
+}
+
+func TestDeactivateReturnsUserWhenRevocationIsNotRecorded(t *testing.T) {
+	u := newTestUser(t, newFakeAPI(t, PassageUser{ID: "user-1", Status: StatusActive}), WithRevocationStore(failingRevocationStore{}))
+
+	user, err := u.Deactivate("user-1")
+	assert.ErrorIs(t, err, ErrRevocationNotRecorded)
+	assert.ErrorContains(t, err, "store unavailable")
+	require.NotNil(t, user)
+	assert.Equal(t, StatusInactive, user.Status)
+
+	assert.ErrorIs(t, u.Delete("user-1"), ErrRevocationNotRecorded)
+}
@@ -0,0 +1,104 @@
+package passage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// defaultHTTPSenderTimeout limits each request of an HTTPSender using the default client, so a hung endpoint
+// doesn't block SendMagicLink.
+const defaultHTTPSenderTimeout = 10 * time.Second
+
+// HTTPSenderOptions configures an HTTPSender.
+type HTTPSenderOptions struct {
+	// Client sends the requests. Defaults to a client whose requests time out after 10 seconds.
+	Client *http.Client
+	// Header is added to every request, for example to authenticate with the endpoint.
+	Header http.Header
+	// Secret, when set, signs every request with a Passage-Signature header in the same format as Passage
+	// webhooks, so the endpoint can verify requests the same way.
+	Secret string
+}
+
+// HTTPSender is a Sender that posts every message as JSON to an HTTP endpoint, such as a service that delivers
+// email or SMS.
+type HTTPSender struct {
+	url    string
+	client *http.Client
+	header http.Header
+	secret string
+}
+
+type httpSenderPayload struct {
+	Channel   ChannelType       `json:"channel"`
+	To        string            `json:"to"`
+	Language  MagicLinkLanguage `json:"language"`
+	Subject   string            `json:"subject,omitempty"`
+	Body      string            `json:"body"`
+	MagicLink MagicLink         `json:"magic_link"`
+}
+
+// NewHTTPSender creates an HTTPSender that posts messages to url.
+func NewHTTPSender(url string, opts *HTTPSenderOptions) (*HTTPSender, error) {
+	if url == "" {
+		return nil, errors.New("url is required.")
+	}
+
+	s := &HTTPSender{url: url, client: &http.Client{Timeout: defaultHTTPSenderTimeout}}
+	if opts != nil {
+		if opts.Client != nil {
+			s.client = opts.Client
+		}
+		s.header = opts.Header.Clone()
+		s.secret = opts.Secret
+	}
+
+	return s, nil
+}
+
+// Send implements Sender. Any response other than 2xx is an error.
+func (s *HTTPSender) Send(ctx context.Context, message MagicLinkMessage) error {
+	body, err := json.Marshal(httpSenderPayload{
+		Channel:   message.Channel,
+		To:        message.To,
+		Language:  message.Language,
+		Subject:   message.Subject,
+		Body:      message.Body,
+		MagicLink: message.MagicLink,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	for key, values := range s.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(s.secret, time.Now(), body))
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("sender endpoint responded with %d: %s", res.StatusCode, bytes.TrimSpace(detail))
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package passage
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTPSenderOptions configures an SMTPSender.
+type SMTPSenderOptions struct {
+	// Addr is the host:port of the SMTP server.
+	Addr string
+	// From is the sender address, such as "Example <no-reply@example.com>".
+	From string
+	// Auth authenticates with the server when set, for example with smtp.PlainAuth.
+	Auth smtp.Auth
+	// TLSConfig is used for STARTTLS. Defaults to verifying the server's certificate for the host in Addr.
+	TLSConfig *tls.Config
+	// InsecureAllowPlaintext sends messages without encryption when the server doesn't offer STARTTLS. By default
+	// such servers are refused, since magic links in a message are credentials anyone reading them can use.
+	InsecureAllowPlaintext bool
+}
+
+// SMTPSender is a Sender that delivers email messages through an SMTP server. It can't deliver phone messages.
+type SMTPSender struct {
+	addr      string
+	host      string
+	from      *mail.Address
+	auth      smtp.Auth
+	tlsConfig *tls.Config
+	plaintext bool
+}
+
+// NewSMTPSender creates an SMTPSender.
+func NewSMTPSender(opts SMTPSenderOptions) (*SMTPSender, error) {
+	host, _, err := net.SplitHostPort(opts.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("Addr must be a host:port: %w", err)
+	}
+
+	from, err := mail.ParseAddress(opts.From)
+	if err != nil {
+		return nil, fmt.Errorf("From must be an email address: %w", err)
+	}
+
+	tlsConfig := opts.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: host}
+	}
+
+	return &SMTPSender{
+		addr:      opts.Addr,
+		host:      host,
+		from:      from,
+		auth:      opts.Auth,
+		tlsConfig: tlsConfig,
+		plaintext: opts.InsecureAllowPlaintext,
+	}, nil
+}
+
+// Send implements Sender.
+func (s *SMTPSender) Send(ctx context.Context, message MagicLinkMessage) error {
+	if message.Channel != EmailChannel {
+		return fmt.Errorf("SMTPSender can't send %s messages", message.Channel)
+	}
+
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %w", message.To, err)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	// unblock the exchange if ctx is canceled while the server is slow to respond
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(s.tlsConfig); err != nil {
+			return err
+		}
+	} else if !s.plaintext {
+		return fmt.Errorf("SMTP server %s doesn't support STARTTLS", s.addr)
+	}
+
+	if s.auth != nil {
+		if err := client.Auth(s.auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(s.from.Address); err != nil {
+		return err
+	}
+
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(s.compose(to, message)); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	if err := client.Quit(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *SMTPSender) compose(to *mail.Address, message MagicLinkMessage) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", s.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Content-Language: %s\r\n", message.Language)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	_, _ = qp.Write([]byte(message.Body))
+	_ = qp.Close()
+
+	return buf.Bytes()
+}
@@ -0,0 +1,53 @@
+package passage
+
+import (
+	"context"
+	"sync"
+)
+
+// flightGroup collapses concurrent calls with the same key into a single execution whose result is shared.
+type flightGroup[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall[T]
+}
+
+type flightCall[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+}
+
+// do runs fn once for all concurrent callers with the same key. fn runs with a context that is not cancelled
+// when the first caller gives up, so the remaining callers still get a result; each caller stops waiting
+// when its own ctx is done.
+func (g *flightGroup[T]) do(ctx context.Context, key string, fn func(ctx context.Context) (T, error)) (T, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*flightCall[T]{}
+	}
+
+	call, ok := g.calls[key]
+	if !ok {
+		call = &flightCall[T]{done: make(chan struct{})}
+		g.calls[key] = call
+
+		go func() {
+			call.val, call.err = fn(context.WithoutCancel(ctx))
+
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+
+			close(call.done)
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.val, call.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
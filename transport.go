@@ -0,0 +1,216 @@
+package passage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultDialTimeout           = 5 * time.Second
+	defaultTLSHandshakeTimeout   = 5 * time.Second
+	defaultResponseHeaderTimeout = 10 * time.Second
+	defaultRequestTimeout        = 30 * time.Second
+	defaultJWKSTimeout           = 10 * time.Second
+	defaultMaxIdleConns          = 100
+	defaultMaxIdleConnsPerHost   = 10
+	defaultIdleConnTimeout       = 90 * time.Second
+)
+
+// HTTPOptions configures the HTTP clients used for the Passage API and for fetching JWKS. Zero-valued fields use
+// their defaults.
+type HTTPOptions struct {
+	// DialTimeout limits how long connecting takes. Defaults to 5 seconds.
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout limits how long the TLS handshake takes. Defaults to 5 seconds.
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout limits how long the server takes to respond once a request is sent. Defaults to
+	// 10 seconds.
+	ResponseHeaderTimeout time.Duration
+	// Timeout limits how long each API request takes, from sending it to reading its response. Time spent waiting
+	// for a rate limit is not included. Defaults to 30 seconds.
+	Timeout time.Duration
+	// JWKSTimeout limits how long fetching the app's JWKS takes, both initially and when it is refreshed.
+	// Defaults to 10 seconds.
+	JWKSTimeout time.Duration
+	// MaxIdleConns and MaxIdleConnsPerHost limit the idle connections kept for reuse. They default to 100 and 10.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limits the connections to the Passage API. It is unlimited by default.
+	MaxConnsPerHost int
+	// IdleConnTimeout is how long an idle connection is kept. Defaults to 90 seconds.
+	IdleConnTimeout time.Duration
+}
+
+// WithHTTPOptions configures timeouts and connection pooling for requests made by the SDK.
+func WithHTTPOptions(opts HTTPOptions) Option {
+	return func(cfg *config) error {
+		if opts.DialTimeout < 0 || opts.TLSHandshakeTimeout < 0 || opts.ResponseHeaderTimeout < 0 ||
+			opts.Timeout < 0 || opts.JWKSTimeout < 0 || opts.MaxIdleConns < 0 || opts.MaxIdleConnsPerHost < 0 ||
+			opts.MaxConnsPerHost < 0 || opts.IdleConnTimeout < 0 {
+			return errors.New("HTTP options must not be negative.")
+		}
+
+		cfg.http = opts
+		return nil
+	}
+}
+
+func (opts HTTPOptions) withDefaults() HTTPOptions {
+	defaults := HTTPOptions{
+		DialTimeout:           defaultDialTimeout,
+		TLSHandshakeTimeout:   defaultTLSHandshakeTimeout,
+		ResponseHeaderTimeout: defaultResponseHeaderTimeout,
+		Timeout:               defaultRequestTimeout,
+		JWKSTimeout:           defaultJWKSTimeout,
+		MaxIdleConns:          defaultMaxIdleConns,
+		MaxIdleConnsPerHost:   defaultMaxIdleConnsPerHost,
+		IdleConnTimeout:       defaultIdleConnTimeout,
+	}
+
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = defaults.DialTimeout
+	}
+	if opts.TLSHandshakeTimeout == 0 {
+		opts.TLSHandshakeTimeout = defaults.TLSHandshakeTimeout
+	}
+	if opts.ResponseHeaderTimeout == 0 {
+		opts.ResponseHeaderTimeout = defaults.ResponseHeaderTimeout
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = defaults.Timeout
+	}
+	if opts.JWKSTimeout == 0 {
+		opts.JWKSTimeout = defaults.JWKSTimeout
+	}
+	if opts.MaxIdleConns == 0 {
+		opts.MaxIdleConns = defaults.MaxIdleConns
+	}
+	if opts.MaxIdleConnsPerHost == 0 {
+		opts.MaxIdleConnsPerHost = defaults.MaxIdleConnsPerHost
+	}
+	if opts.IdleConnTimeout == 0 {
+		opts.IdleConnTimeout = defaults.IdleConnTimeout
+	}
+
+	return opts
+}
+
+// roundTripperFunc adapts a function to an http.RoundTripper.
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newTransport(opts HTTPOptions) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   opts.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          opts.MaxIdleConns,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+	}
+}
+
+// newHTTPClient returns the client requests to the Passage API are made with, wrapping the transport with the
+// behavior configured by cfg.
+func newHTTPClient(cfg config) *http.Client {
+	opts := cfg.http.withDefaults()
+
+	var transport http.RoundTripper = newTransport(opts)
+	transport = withRequestTimeout(transport, opts.Timeout)
+
+	if cfg.rateLimiter != nil {
+		transport = cfg.rateLimiter.wrap(transport)
+	}
+
+	// the circuit breaker is outside the rate limiter so requests fail fast without waiting for it
+	if cfg.breaker != nil {
+		transport = cfg.breaker.wrap(transport)
+	}
+
+	// a request retried with the secondary API key is rate limited and seen by the circuit breaker like any other
+	if cfg.credentials != nil {
+		transport = withCredentials(transport, cfg.credentials)
+	}
+
+	transport = withRetry(transport, cfg.retry)
+
+	// identical requests share one request, including any retries of it
+	if cfg.deduper != nil {
+		transport = cfg.deduper.wrap(transport)
+	}
+
+	transport = withCallTimeout(transport)
+	transport = withResponseCapture(transport)
+
+	return &http.Client{Transport: transport}
+}
+
+// newJWKSClient returns the client JWKS are fetched with.
+func newJWKSClient(cfg config) *http.Client {
+	opts := cfg.http.withDefaults()
+
+	return &http.Client{
+		Transport: newTransport(opts),
+		Timeout:   opts.JWKSTimeout,
+	}
+}
+
+// withRequestTimeout limits each request to timeout, including reading its response body.
+func withRequestTimeout(next http.RoundTripper, timeout time.Duration) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return roundTripWithTimeout(next, req, timeout)
+	})
+}
+
+// withCallTimeout limits each request to the timeout given with CallTimeout, if any.
+func withCallTimeout(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		timeout := callOptionsFrom(req.Context()).timeout
+		if timeout <= 0 {
+			return next.RoundTrip(req)
+		}
+
+		return roundTripWithTimeout(next, req, timeout)
+	})
+}
+
+func roundTripWithTimeout(next http.RoundTripper, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+
+	res, err := next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+// cancelOnClose cancels a request's context once its response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,275 @@
+package passage
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerConsecutiveFailures = 5
+	defaultBreakerMinRequests         = 10
+	defaultBreakerWindow              = time.Minute
+	defaultBreakerOpenTimeout         = 30 * time.Second
+	defaultBreakerHalfOpenRequests    = 1
+)
+
+// ErrCircuitOpen is returned for requests made while the circuit breaker configured with WithCircuitBreaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState string
+
+const (
+	// CircuitClosed lets every request through.
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen fails every request with ErrCircuitOpen.
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a few trial requests through to find out whether the Passage API has recovered.
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitBreakerOptions configures WithCircuitBreaker. Zero-valued fields use their defaults.
+type CircuitBreakerOptions struct {
+	// ConsecutiveFailures opens the circuit after this many failed requests in a row. Defaults to 5.
+	ConsecutiveFailures int
+	// FailureRatio opens the circuit once this fraction of the requests within Window have failed, as long as
+	// there were at least MinRequests of them. It is not used when it is 0.
+	FailureRatio float64
+	// MinRequests defaults to 10.
+	MinRequests int
+	// Window is how often the counts used by FailureRatio are reset. Defaults to 1 minute.
+	Window time.Duration
+	// OpenTimeout is how long the circuit stays open before trial requests are let through. Defaults to 30 seconds.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of trial requests let through while half open. The circuit closes once they
+	// all succeed and opens again if any of them fails. Defaults to 1.
+	HalfOpenRequests int
+	// OnStateChange, when set, is called whenever the circuit changes state.
+	OnStateChange func(from, to CircuitState)
+}
+
+// WithCircuitBreaker makes requests to the Passage API fail fast with ErrCircuitOpen while the API is failing,
+// rather than each waiting for its own timeout. Network errors and 5xx responses count as failures.
+func WithCircuitBreaker(opts CircuitBreakerOptions) Option {
+	return func(cfg *config) error {
+		if opts.FailureRatio < 0 || opts.FailureRatio > 1 {
+			return errors.New("FailureRatio must be between 0 and 1.")
+		}
+
+		if opts.ConsecutiveFailures < 0 || opts.MinRequests < 0 || opts.HalfOpenRequests < 0 ||
+			opts.Window < 0 || opts.OpenTimeout < 0 {
+			return errors.New("circuit breaker options must not be negative.")
+		}
+
+		cfg.breaker = newCircuitBreaker(opts)
+		return nil
+	}
+}
+
+type circuitBreaker struct {
+	opts CircuitBreakerOptions
+	now  func() time.Time
+
+	mu          sync.Mutex
+	state       CircuitState
+	consecutive int
+	requests    int
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+	// trials and successes count the trial requests let through and succeeded while half open.
+	trials    int
+	successes int
+}
+
+type circuitTransition struct {
+	from, to CircuitState
+}
+
+func newCircuitBreaker(opts CircuitBreakerOptions) *circuitBreaker {
+	if opts.ConsecutiveFailures == 0 {
+		opts.ConsecutiveFailures = defaultBreakerConsecutiveFailures
+	}
+	if opts.MinRequests == 0 {
+		opts.MinRequests = defaultBreakerMinRequests
+	}
+	if opts.Window == 0 {
+		opts.Window = defaultBreakerWindow
+	}
+	if opts.OpenTimeout == 0 {
+		opts.OpenTimeout = defaultBreakerOpenTimeout
+	}
+	if opts.HalfOpenRequests == 0 {
+		opts.HalfOpenRequests = defaultBreakerHalfOpenRequests
+	}
+
+	return &circuitBreaker{
+		opts:  opts,
+		now:   time.Now,
+		state: CircuitClosed,
+	}
+}
+
+func (b *circuitBreaker) wrap(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		admitted, ok := b.allow()
+		if !ok {
+			return nil, ErrCircuitOpen
+		}
+
+		res, err := next.RoundTrip(req)
+
+		switch {
+		case err == nil:
+			b.record(admitted, res.StatusCode < 500)
+		case req.Context().Err() == nil:
+			b.record(admitted, false)
+		default:
+			// a request abandoned by its caller says nothing about the health of the API
+			b.release(admitted)
+		}
+
+		return res, err
+	})
+}
+
+// currentState returns the state of the circuit, moving from open to half open once OpenTimeout has passed.
+func (b *circuitBreaker) currentState() CircuitState {
+	b.mu.Lock()
+	transition := b.advance()
+	state := b.state
+	b.mu.Unlock()
+
+	b.notify(transition)
+	return state
+}
+
+// allow reports whether a request may be made and the state it is made in.
+func (b *circuitBreaker) allow() (CircuitState, bool) {
+	b.mu.Lock()
+	transition := b.advance()
+	state := b.state
+
+	allowed := true
+	switch state {
+	case CircuitOpen:
+		allowed = false
+	case CircuitHalfOpen:
+		if b.trials >= b.opts.HalfOpenRequests {
+			allowed = false
+		} else {
+			b.trials++
+		}
+	}
+	b.mu.Unlock()
+
+	b.notify(transition)
+	return state, allowed
+}
+
+// record counts the outcome of a request let through in state admitted. Outcomes of requests admitted in an earlier
+// state are ignored.
+func (b *circuitBreaker) record(admitted CircuitState, success bool) {
+	b.mu.Lock()
+	var transition *circuitTransition
+	if admitted == b.state {
+		switch b.state {
+		case CircuitClosed:
+			transition = b.recordClosed(success)
+		case CircuitHalfOpen:
+			if !success {
+				transition = b.setState(CircuitOpen)
+			} else if b.successes++; b.successes >= b.opts.HalfOpenRequests {
+				transition = b.setState(CircuitClosed)
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	b.notify(transition)
+}
+
+// release frees the trial slot of a request let through in state admitted without counting its outcome.
+func (b *circuitBreaker) release(admitted CircuitState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if admitted == CircuitHalfOpen && b.state == CircuitHalfOpen {
+		b.trials--
+	}
+}
+
+func (b *circuitBreaker) recordClosed(success bool) *circuitTransition {
+	b.requests++
+	if success {
+		b.consecutive = 0
+		return nil
+	}
+
+	b.failures++
+	b.consecutive++
+
+	if b.consecutive >= b.opts.ConsecutiveFailures {
+		return b.setState(CircuitOpen)
+	}
+
+	if b.opts.FailureRatio > 0 && b.requests >= b.opts.MinRequests &&
+		float64(b.failures)/float64(b.requests) >= b.opts.FailureRatio {
+		return b.setState(CircuitOpen)
+	}
+
+	return nil
+}
+
+// advance moves an open circuit to half open after OpenTimeout and resets the counts of a closed circuit every
+// Window. b.mu must be held.
+func (b *circuitBreaker) advance() *circuitTransition {
+	now := b.now()
+
+	switch b.state {
+	case CircuitOpen:
+		if now.Sub(b.openedAt) >= b.opts.OpenTimeout {
+			return b.setState(CircuitHalfOpen)
+		}
+	case CircuitClosed:
+		if now.Sub(b.windowStart) >= b.opts.Window {
+			b.windowStart = now
+			b.requests, b.failures = 0, 0
+		}
+	}
+
+	return nil
+}
+
+// setState changes the state and resets the counts. b.mu must be held.
+func (b *circuitBreaker) setState(state CircuitState) *circuitTransition {
+	transition := &circuitTransition{from: b.state, to: state}
+
+	b.state = state
+	b.consecutive, b.requests, b.failures = 0, 0, 0
+	b.trials, b.successes = 0, 0
+	b.windowStart = b.now()
+	if state == CircuitOpen {
+		b.openedAt = b.now()
+	}
+
+	return transition
+}
+
+func (b *circuitBreaker) notify(transition *circuitTransition) {
+	if transition != nil && b.opts.OnStateChange != nil {
+		b.opts.OnStateChange(transition.from, transition.to)
+	}
+}
+
+// CircuitState returns the state of the circuit breaker configured with WithCircuitBreaker. It returns
+// CircuitClosed if no circuit breaker is configured.
+func (p *Passage) CircuitState() CircuitState {
+	if p.breaker == nil {
+		return CircuitClosed
+	}
+
+	return p.breaker.currentState()
+}
@@ -0,0 +1,193 @@
+package passage
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withBreaker is an Option that installs breaker, so tests can control its clock and inspect its state.
+func withBreaker(breaker *circuitBreaker) Option {
+	return func(cfg *config) error {
+		cfg.breaker = breaker
+		return nil
+	}
+}
+
+// flakyAPI serves the fake user API, or 500 for every request while failing is set.
+type flakyAPI struct {
+	api      *fakeAPI
+	failing  atomic.Bool
+	requests atomic.Int32
+}
+
+func (f *flakyAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests.Add(1)
+	if f.failing.Load() {
+		writeJSON(f.api.t, w, http.StatusInternalServerError, N500Error{Code: InternalServerError, Error: "boom"})
+		return
+	}
+	f.api.ServeHTTP(w, r)
+}
+
+type transitionRecorder struct {
+	mu          sync.Mutex
+	transitions [][2]CircuitState
+}
+
+func (r *transitionRecorder) record(from, to CircuitState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transitions = append(r.transitions, [2]CircuitState{from, to})
+}
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	api := &flakyAPI{api: newFakeAPI(t, PassageUser{ID: "user-1"})}
+	api.failing.Store(true)
+
+	var recorder transitionRecorder
+	breaker := newCircuitBreaker(CircuitBreakerOptions{
+		ConsecutiveFailures: 3,
+		OpenTimeout:         time.Minute,
+		OnStateChange:       recorder.record,
+	})
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	u := newTestUser(t, api, withBreaker(breaker))
+
+	for i := 0; i < 3; i++ {
+		err := u.RevokeRefreshTokens("user-1")
+		var passageErr PassageError
+		require.ErrorAs(t, err, &passageErr)
+	}
+	assert.Equal(t, CircuitOpen, breaker.currentState())
+
+	// requests fail fast without reaching the API
+	err := u.RevokeRefreshTokens("user-1")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(3), api.requests.Load())
+
+	// a failed trial request opens the circuit again
+	now = now.Add(time.Minute)
+	assert.Equal(t, CircuitHalfOpen, breaker.currentState())
+	assert.Error(t, u.RevokeRefreshTokens("user-1"))
+	assert.Equal(t, CircuitOpen, breaker.currentState())
+
+	// a successful trial request closes it
+	now = now.Add(time.Minute)
+	api.failing.Store(false)
+	require.NoError(t, u.RevokeRefreshTokens("user-1"))
+	assert.Equal(t, CircuitClosed, breaker.currentState())
+
+	assert.Equal(t, [][2]CircuitState{
+		{CircuitClosed, CircuitOpen},
+		{CircuitOpen, CircuitHalfOpen},
+		{CircuitHalfOpen, CircuitOpen},
+		{CircuitOpen, CircuitHalfOpen},
+		{CircuitHalfOpen, CircuitClosed},
+	}, recorder.transitions)
+}
+
+func TestCircuitBreakerFailureRatio(t *testing.T) {
+	breaker := newCircuitBreaker(CircuitBreakerOptions{
+		ConsecutiveFailures: 100,
+		FailureRatio:        0.5,
+		MinRequests:         4,
+	})
+
+	outcomes := []bool{true, false, true, false}
+	for i, success := range outcomes {
+		state, ok := breaker.allow()
+		require.True(t, ok)
+		breaker.record(state, success)
+
+		if i < len(outcomes)-1 {
+			assert.Equal(t, CircuitClosed, breaker.currentState())
+		}
+	}
+
+	assert.Equal(t, CircuitOpen, breaker.currentState())
+}
+
+func TestCircuitBreakerWindowResetsCounts(t *testing.T) {
+	breaker := newCircuitBreaker(CircuitBreakerOptions{
+		ConsecutiveFailures: 100,
+		FailureRatio:        0.5,
+		MinRequests:         2,
+		Window:              time.Minute,
+	})
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	state, _ := breaker.allow()
+	breaker.record(state, false)
+
+	now = now.Add(2 * time.Minute)
+	state, _ = breaker.allow()
+	breaker.record(state, true)
+
+	assert.Equal(t, CircuitClosed, breaker.currentState())
+}
+
+func TestCircuitBreakerLimitsHalfOpenTrials(t *testing.T) {
+	breaker := newCircuitBreaker(CircuitBreakerOptions{ConsecutiveFailures: 1, HalfOpenRequests: 2})
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	state, _ := breaker.allow()
+	breaker.record(state, false)
+
+	now = now.Add(defaultBreakerOpenTimeout)
+	first, ok := breaker.allow()
+	require.True(t, ok)
+	second, ok := breaker.allow()
+	require.True(t, ok)
+	_, ok = breaker.allow()
+	assert.False(t, ok)
+
+	// an abandoned trial frees its slot
+	breaker.release(second)
+	_, ok = breaker.allow()
+	assert.True(t, ok)
+
+	breaker.record(first, true)
+	assert.Equal(t, CircuitHalfOpen, breaker.currentState())
+	breaker.record(first, true)
+	assert.Equal(t, CircuitClosed, breaker.currentState())
+}
+
+func TestCircuitBreakerIgnoresCanceledRequests(t *testing.T) {
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+
+	breaker := newCircuitBreaker(CircuitBreakerOptions{ConsecutiveFailures: 1})
+	u := newTestUser(t, handler, withBreaker(breaker))
+	t.Cleanup(func() { close(release) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := u.revokeRefreshTokens(ctx, "user-1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, CircuitClosed, breaker.currentState())
+}
+
+func TestWithCircuitBreakerValidates(t *testing.T) {
+	for _, opts := range []CircuitBreakerOptions{
+		{FailureRatio: 1.5},
+		{ConsecutiveFailures: -1},
+		{OpenTimeout: -time.Second},
+	} {
+		_, err := newConfig([]Option{WithCircuitBreaker(opts)})
+		assert.Error(t, err)
+	}
+}
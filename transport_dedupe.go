@@ -0,0 +1,182 @@
+package passage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDedupeWindow   = 10 * time.Second
+	defaultDedupeCapacity = 1000
+)
+
+// DedupeOptions configures WithDedupe. Zero-valued fields use their defaults.
+type DedupeOptions struct {
+	// Window is how long the result of a request is returned for identical requests. Defaults to 10 seconds.
+	Window time.Duration
+	// Capacity is the number of results kept. Defaults to 1000.
+	Capacity int
+}
+
+// WithDedupe makes identical POST requests to the Passage API, such as repeated User.Create or
+// CreateMagicLinkWithEmail calls with the same arguments, share a single request: an identical request made while
+// one is in flight, or within the window after it succeeded, gets its response instead of being sent. Requests are
+// identical when their URL, headers and body are, so calls setting different headers with CallHeader or
+// CallIdempotencyKey don't share requests. Calls using CallTimeout, CallRetry or CallRequestEditor are never
+// deduplicated.
+func WithDedupe(opts DedupeOptions) Option {
+	return func(cfg *config) error {
+		if opts.Window < 0 || opts.Capacity < 0 {
+			return errors.New("dedupe options must not be negative.")
+		}
+
+		cfg.deduper = newDeduper(opts)
+		return nil
+	}
+}
+
+type deduper struct {
+	window  time.Duration
+	results *LRUCache
+	flights flightGroup[*dedupedResponse]
+}
+
+// dedupedResponse is a response shared by identical requests.
+type dedupedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+func newDeduper(opts DedupeOptions) *deduper {
+	if opts.Window == 0 {
+		opts.Window = defaultDedupeWindow
+	}
+	if opts.Capacity == 0 {
+		opts.Capacity = defaultDedupeCapacity
+	}
+
+	return &deduper{
+		window:  opts.Window,
+		results: NewLRUCache(opts.Capacity),
+	}
+}
+
+func (d *deduper) wrap(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		// a body that can't be read twice can't be compared with other requests
+		if req.Method != http.MethodPost || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+			return next.RoundTrip(req)
+		}
+
+		// the shared request is made with the first caller's context, so only calls whose options don't change how
+		// it is made can share it; options changing what is sent are part of the key
+		if opts := callOptionsFrom(req.Context()); opts.timeout > 0 || opts.retry != nil || len(opts.editors) > 0 {
+			return next.RoundTrip(req)
+		}
+
+		key, err := dedupeKey(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if cached, ok, _ := d.results.Get(req.Context(), key); ok {
+			var res dedupedResponse
+			if err := json.Unmarshal(cached, &res); err == nil {
+				return res.toResponse(req), nil
+			}
+		}
+
+		res, err := d.flights.do(req.Context(), key, func(ctx context.Context) (*dedupedResponse, error) {
+			return d.send(ctx, next, req, key)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return res.toResponse(req), nil
+	})
+}
+
+// send makes req and remembers its response for the window if it succeeded.
+func (d *deduper) send(ctx context.Context, next http.RoundTripper, req *http.Request, key string) (*dedupedResponse, error) {
+	sent := req.WithContext(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		sent.Body = body
+	}
+
+	res, err := next.RoundTrip(sent)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	deduped := &dedupedResponse{StatusCode: res.StatusCode, Header: res.Header, Body: body}
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		if encoded, err := json.Marshal(deduped); err == nil {
+			_ = d.results.Set(ctx, key, encoded, d.window)
+		}
+	}
+
+	return deduped, nil
+}
+
+func (r *dedupedResponse) toResponse(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// dedupeKey identifies requests that are identical.
+func dedupeKey(req *http.Request) (string, error) {
+	hash := sha256.New()
+	hash.Write([]byte(req.Method + " " + req.URL.String() + "\n"))
+
+	// the headers include those set with CallHeader and CallIdempotencyKey
+	for _, name := range slices.Sorted(maps.Keys(req.Header)) {
+		hash.Write([]byte(name + ": " + strings.Join(req.Header[name], ", ") + "\n"))
+	}
+	hash.Write([]byte("\n"))
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		defer body.Close()
+
+		if _, err := io.Copy(hash, body); err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
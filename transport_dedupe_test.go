@@ -0,0 +1,215 @@
+package passage
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// droppingServer passes requests to next but drops the connection instead of responding to the first drop of
+// them, as if the response was lost on the network after the request was processed.
+type droppingServer struct {
+	next     http.Handler
+	drop     atomic.Int32
+	requests atomic.Int32
+}
+
+func (s *droppingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+
+	recorded := httptest.NewRecorder()
+	s.next.ServeHTTP(recorded, r)
+
+	if s.drop.Add(-1) >= 0 {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+		return
+	}
+
+	for name, values := range recorded.Header() {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(recorded.Code)
+	w.Write(recorded.Body.Bytes())
+}
+
+func TestCreateWithDroppedResponseIsNotRetried(t *testing.T) {
+	api := newFakeAPI(t)
+	server := &droppingServer{next: api}
+	server.drop.Store(1)
+	u := newTestUser(t, server, WithRetry(fastRetry))
+
+	// the user was created, but retrying could create them twice
+	_, err := u.Create(CreateUserArgs{Email: "a@example.com"}, CallIdempotencyKey("create-a"))
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), server.requests.Load())
+	assert.Equal(t, 1, api.count("create"))
+}
+
+func TestDedupeReturnsFirstResult(t *testing.T) {
+	api := newFakeAPI(t)
+	deduper := newDeduper(DedupeOptions{Window: time.Minute})
+	now := time.Now()
+	deduper.results.now = func() time.Time { return now }
+	u := newTestUser(t, api, withDeduper(deduper))
+
+	first, err := u.Create(CreateUserArgs{Email: "a@example.com"})
+	require.NoError(t, err)
+
+	repeated, err := u.Create(CreateUserArgs{Email: "a@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, repeated.ID)
+	assert.Equal(t, 1, api.count("create"))
+
+	// different requests aren't deduplicated
+	_, err = u.Create(CreateUserArgs{Email: "b@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, api.count("create"))
+
+	// once the window has passed, the request is sent again
+	now = now.Add(2 * time.Minute)
+	_, err = u.Create(CreateUserArgs{Email: "a@example.com"})
+	var passageErr PassageError
+	require.ErrorAs(t, err, &passageErr)
+	assert.Equal(t, http.StatusConflict, passageErr.StatusCode)
+	assert.Equal(t, 3, api.count("create"))
+}
+
+func TestDedupeDoesNotRememberFailures(t *testing.T) {
+	handler, requests := failFirst(t, 1, http.StatusInternalServerError, newFakeAPI(t))
+	u := newTestUser(t, handler, WithDedupe(DedupeOptions{}))
+
+	_, err := u.Create(CreateUserArgs{Email: "a@example.com"})
+	assert.Error(t, err)
+
+	_, err = u.Create(CreateUserArgs{Email: "a@example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestDedupeSharesConcurrentRequests(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		writeJSON(t, w, http.StatusCreated, UserResponse{PassageUser: PassageUser{ID: "user-1"}})
+	}), WithDedupe(DedupeOptions{}))
+
+	var wg sync.WaitGroup
+	ids := make([]string, 5)
+	for i := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, err := u.Create(CreateUserArgs{Email: "a@example.com"})
+			if assert.NoError(t, err) {
+				ids[i] = user.ID
+			}
+		}()
+	}
+
+	require.Eventually(t, func() bool { return requests.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), requests.Load())
+	assert.Equal(t, []string{"user-1", "user-1", "user-1", "user-1", "user-1"}, ids)
+}
+
+func TestDedupeMagicLinks(t *testing.T) {
+	auth, requests, _ := newMagicLinkTestAuth(t, WithDedupe(DedupeOptions{}))
+
+	for i := 0; i < 3; i++ {
+		link, err := auth.CreateMagicLinkWithEmail("a@example.com", LoginType, false, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "magic-link-1", link.ID)
+	}
+	assert.Equal(t, int32(1), requests.Load())
+
+	_, err := auth.CreateMagicLinkWithEmail("b@example.com", LoginType, false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestDedupeKeyIncludesBody(t *testing.T) {
+	newRequest := func(body string) *http.Request {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "https://example.com/users", bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		return req
+	}
+
+	a, err := dedupeKey(newRequest(`{"email":"a@example.com"}`))
+	require.NoError(t, err)
+	b, err := dedupeKey(newRequest(`{"email":"b@example.com"}`))
+	require.NoError(t, err)
+	again, err := dedupeKey(newRequest(`{"email":"a@example.com"}`))
+	require.NoError(t, err)
+
+	assert.NotEqual(t, a, b)
+	assert.Equal(t, a, again)
+}
+
+func TestDedupeKeyIncludesHeaders(t *testing.T) {
+	newRequest := func(name, value string) *http.Request {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "https://example.com/users", nil)
+		require.NoError(t, err)
+		if name != "" {
+			req.Header.Set(name, value)
+		}
+		return req
+	}
+
+	plain, err := dedupeKey(newRequest("", ""))
+	require.NoError(t, err)
+	tenantA, err := dedupeKey(newRequest("X-Tenant", "a"))
+	require.NoError(t, err)
+	tenantB, err := dedupeKey(newRequest("X-Tenant", "b"))
+	require.NoError(t, err)
+	keyed, err := dedupeKey(newRequest(idempotencyKeyHeader, "create-a"))
+	require.NoError(t, err)
+
+	assert.Len(t, map[string]bool{plain: true, tenantA: true, tenantB: true, keyed: true}, 4)
+}
+
+func TestDedupeSkipsCallsWithOptions(t *testing.T) {
+	api := newFakeAPI(t)
+	u := newTestUser(t, api, WithDedupe(DedupeOptions{}))
+
+	_, err := u.Create(CreateUserArgs{Email: "a@example.com"})
+	require.NoError(t, err)
+
+	// a different header makes a different request
+	_, err = u.Create(CreateUserArgs{Email: "a@example.com"}, CallHeader("X-Tenant", "a"))
+	assert.Error(t, err)
+	assert.Equal(t, 2, api.count("create"))
+
+	for _, opt := range []CallOption{
+		CallTimeout(time.Minute),
+		CallRetry(RetryOptions{MaxAttempts: 1}),
+		CallRequestEditor(func(context.Context, *http.Request) error { return nil }),
+	} {
+		_, err = u.Create(CreateUserArgs{Email: "a@example.com"}, opt)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 5, api.count("create"))
+}
+
+// withDeduper is an Option that installs deduper, so tests can control its clock.
+func withDeduper(deduper *deduper) Option {
+	return func(cfg *config) error {
+		cfg.deduper = deduper
+		return nil
+	}
+}
@@ -0,0 +1,246 @@
+package passage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// minRateFactor bounds how far the rate is lowered after repeated 429 responses.
+	minRateFactor = 0.1
+	// rateFactorRecovery is how much of the configured rate is restored by each response that isn't a 429.
+	rateFactorRecovery = 0.05
+)
+
+// RateLimit is a rate of requests.
+type RateLimit struct {
+	// RequestsPerSecond is the sustained rate of requests.
+	RequestsPerSecond float64
+	// Burst is the number of requests that may be made at once after a quiet period. Defaults to 1.
+	Burst int
+}
+
+// RateLimitOptions configures WithRateLimit.
+type RateLimitOptions struct {
+	RateLimit
+	// Operations overrides the rate limit for individual operations. Requests for these operations are only
+	// limited by their own rate.
+	Operations map[Operation]RateLimit
+}
+
+// RateLimitStats describes the requests a rate limiter has handled.
+type RateLimitStats struct {
+	// Requests is the number of requests made.
+	Requests int64
+	// Delayed is the number of requests that waited for the rate limiter.
+	Delayed int64
+	// TotalWait and MaxWait are the total and longest time requests waited.
+	TotalWait time.Duration
+	MaxWait   time.Duration
+	// Throttled is the number of 429 responses received.
+	Throttled int64
+	// RateFactor is the fraction of the configured rates currently in effect. It drops when the Passage API
+	// responds with 429 and recovers as requests succeed.
+	RateFactor float64
+}
+
+// WithRateLimit limits the rate of requests made to the Passage API by both User and Auth. When the API responds
+// with 429 the rate is lowered, and requests are held back for as long as its Retry-After header asks.
+func WithRateLimit(opts RateLimitOptions) Option {
+	return func(cfg *config) error {
+		if err := validateRateLimit(opts.RateLimit); err != nil {
+			return err
+		}
+
+		for operation, limit := range opts.Operations {
+			if err := validateRateLimit(limit); err != nil {
+				return fmt.Errorf("%s: %w", operation, err)
+			}
+		}
+
+		cfg.rateLimiter = newRateLimiter(opts)
+		return nil
+	}
+}
+
+func validateRateLimit(limit RateLimit) error {
+	if limit.RequestsPerSecond <= 0 || math.IsInf(limit.RequestsPerSecond, 0) || math.IsNaN(limit.RequestsPerSecond) {
+		return errors.New("RequestsPerSecond must be positive.")
+	}
+
+	if limit.Burst < 0 {
+		return errors.New("Burst must not be negative.")
+	}
+
+	return nil
+}
+
+type limitedBucket struct {
+	bucket *tokenBucket
+	rate   float64
+}
+
+type rateLimiter struct {
+	global     limitedBucket
+	operations map[Operation]limitedBucket
+	now        func() time.Time
+
+	mu           sync.Mutex
+	factor       float64
+	blockedUntil time.Time
+	stats        RateLimitStats
+}
+
+func newRateLimiter(opts RateLimitOptions) *rateLimiter {
+	l := &rateLimiter{
+		global: limitedBucket{
+			bucket: newTokenBucket(opts.RequestsPerSecond, opts.Burst),
+			rate:   opts.RequestsPerSecond,
+		},
+		operations: map[Operation]limitedBucket{},
+		now:        time.Now,
+		factor:     1,
+	}
+
+	for operation, limit := range opts.Operations {
+		l.operations[operation] = limitedBucket{
+			bucket: newTokenBucket(limit.RequestsPerSecond, limit.Burst),
+			rate:   limit.RequestsPerSecond,
+		}
+	}
+
+	return l
+}
+
+func (l *rateLimiter) bucketFor(operation Operation) *tokenBucket {
+	if limited, ok := l.operations[operation]; ok {
+		return limited.bucket
+	}
+
+	return l.global.bucket
+}
+
+func (l *rateLimiter) wrap(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		waited, err := l.wait(req)
+		l.recordWait(waited)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := next.RoundTrip(req)
+		if err == nil {
+			l.observe(res)
+		}
+
+		return res, err
+	})
+}
+
+func (l *rateLimiter) wait(req *http.Request) (time.Duration, error) {
+	ctx := req.Context()
+
+	var waited time.Duration
+	l.mu.Lock()
+	blocked := l.blockedUntil.Sub(l.now())
+	l.mu.Unlock()
+
+	if blocked > 0 {
+		timer := time.NewTimer(blocked)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			waited += blocked
+		case <-ctx.Done():
+			return waited, ctx.Err()
+		}
+	}
+
+	bucketWait, err := l.bucketFor(operationOf(req)).wait(ctx)
+	return waited + bucketWait, err
+}
+
+func (l *rateLimiter) recordWait(waited time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stats.Requests++
+	if waited > 0 {
+		l.stats.Delayed++
+		l.stats.TotalWait += waited
+		l.stats.MaxWait = max(l.stats.MaxWait, waited)
+	}
+}
+
+// observe adapts the rate to a response: a 429 halves it and holds requests back for the Retry-After delay, and
+// any other response gradually restores it.
+func (l *rateLimiter) observe(res *http.Response) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	factor := l.factor
+	if res.StatusCode == http.StatusTooManyRequests {
+		l.stats.Throttled++
+		factor = max(factor/2, minRateFactor)
+
+		if retryAfter := parseRetryAfter(res.Header.Get("Retry-After"), l.now()); retryAfter > 0 {
+			if until := l.now().Add(retryAfter); until.After(l.blockedUntil) {
+				l.blockedUntil = until
+			}
+		}
+	} else {
+		factor = min(factor+rateFactorRecovery, 1)
+	}
+
+	if factor == l.factor {
+		return
+	}
+
+	l.factor = factor
+	l.global.bucket.setRate(l.global.rate * factor)
+	for _, limited := range l.operations {
+		limited.bucket.setRate(limited.rate * factor)
+	}
+}
+
+func (l *rateLimiter) snapshot() RateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := l.stats
+	stats.RateFactor = l.factor
+	return stats
+}
+
+// parseRetryAfter returns the delay asked for by a Retry-After header, given in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(now)
+	}
+
+	return 0
+}
+
+// RateLimitStats returns statistics of the rate limiter configured with WithRateLimit. It returns zero stats if no
+// rate limit is configured.
+func (p *Passage) RateLimitStats() RateLimitStats {
+	if p.rateLimiter == nil {
+		return RateLimitStats{}
+	}
+
+	return p.rateLimiter.snapshot()
+}
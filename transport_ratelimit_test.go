@@ -0,0 +1,144 @@
+package passage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationOf(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   Operation
+	}{
+		{method: http.MethodPost, path: "/v1/apps/app/magic-links", want: OperationCreateMagicLink},
+		{method: http.MethodGet, path: "/v1/apps/app/users", want: OperationListPaginatedUsers},
+		{method: http.MethodPost, path: "/v1/apps/app/users", want: OperationCreateUser},
+		{method: http.MethodGet, path: "/v1/apps/app/users/u", want: OperationGetUser},
+		{method: http.MethodPatch, path: "/v1/apps/app/users/u", want: OperationUpdateUser},
+		{method: http.MethodDelete, path: "/v1/apps/app/users/u", want: OperationDeleteUser},
+		{method: http.MethodPatch, path: "/v1/apps/app/users/u/activate", want: OperationActivateUser},
+		{method: http.MethodPatch, path: "/v1/apps/app/users/u/deactivate", want: OperationDeactivateUser},
+		{method: http.MethodGet, path: "/v1/apps/app/users/u/devices", want: OperationListUserDevices},
+		{method: http.MethodDelete, path: "/v1/apps/app/users/u/devices/d", want: OperationDeleteUserDevices},
+		{method: http.MethodDelete, path: "/v1/apps/app/users/u/tokens", want: OperationRevokeUserRefreshTokens},
+		{method: http.MethodGet, path: "/apps/app/users/u", want: OperationGetUser},
+		{method: http.MethodGet, path: "/v1/other", want: ""},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		assert.Equal(t, tt.want, operationOf(req), "%s %s", tt.method, tt.path)
+	}
+}
+
+// withLimiter is an Option that installs limiter, so tests can inspect its stats.
+func withLimiter(limiter *rateLimiter) Option {
+	return func(cfg *config) error {
+		cfg.rateLimiter = limiter
+		return nil
+	}
+}
+
+func TestRateLimitSpacesOutRequests(t *testing.T) {
+	limiter := newRateLimiter(RateLimitOptions{RateLimit: RateLimit{RequestsPerSecond: 50, Burst: 1}})
+	u := newTestUser(t, newFakeAPI(t, PassageUser{ID: "user-1"}), withLimiter(limiter))
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		require.NoError(t, u.RevokeRefreshTokens("user-1"))
+	}
+
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	stats := limiter.snapshot()
+	assert.Equal(t, int64(6), stats.Requests)
+	assert.Positive(t, stats.Delayed)
+	assert.Greater(t, stats.TotalWait, time.Duration(0))
+	assert.Greater(t, stats.MaxWait, time.Duration(0))
+	assert.Equal(t, float64(1), stats.RateFactor)
+}
+
+func TestRateLimitOperationOverride(t *testing.T) {
+	limiter := newRateLimiter(RateLimitOptions{
+		RateLimit: RateLimit{RequestsPerSecond: 0.1, Burst: 1},
+		Operations: map[Operation]RateLimit{
+			OperationRevokeUserRefreshTokens: {RequestsPerSecond: 1000, Burst: 10},
+		},
+	})
+	u := newTestUser(t, newFakeAPI(t, PassageUser{ID: "user-1"}), withLimiter(limiter))
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, u.RevokeRefreshTokens("user-1"))
+	}
+
+	// the global limit only allows one request per 10 seconds
+	_, err := u.Activate("user-1")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = u.activate(ctx, "user-1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.Equal(t, int64(0), limiter.snapshot().Delayed)
+}
+
+func TestRateLimitAdaptsToTooManyRequests(t *testing.T) {
+	var requests atomic.Int32
+	api := newFakeAPI(t, PassageUser{ID: "user-1"})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			writeJSON(t, w, http.StatusTooManyRequests, map[string]string{"code": "rate_limited", "error": "slow down"})
+			return
+		}
+		api.ServeHTTP(w, r)
+	})
+
+	limiter := newRateLimiter(RateLimitOptions{RateLimit: RateLimit{RequestsPerSecond: 1000, Burst: 10}})
+	u := newTestUser(t, handler, withLimiter(limiter))
+
+	err := u.RevokeRefreshTokens("user-1")
+	var passageErr PassageError
+	require.ErrorAs(t, err, &passageErr)
+	assert.Equal(t, http.StatusTooManyRequests, passageErr.StatusCode)
+
+	stats := limiter.snapshot()
+	assert.Equal(t, int64(1), stats.Throttled)
+	assert.Equal(t, 0.5, stats.RateFactor)
+
+	start := time.Now()
+	require.NoError(t, u.RevokeRefreshTokens("user-1"))
+	assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+
+	stats = limiter.snapshot()
+	assert.InDelta(t, 0.55, stats.RateFactor, 1e-9)
+	assert.Equal(t, int64(1), stats.Delayed)
+}
+
+func TestWithRateLimitValidates(t *testing.T) {
+	for _, opts := range []RateLimitOptions{
+		{},
+		{RateLimit: RateLimit{RequestsPerSecond: 1, Burst: -1}},
+		{RateLimit: RateLimit{RequestsPerSecond: 1}, Operations: map[Operation]RateLimit{OperationGetUser: {}}},
+	} {
+		_, err := newConfig([]Option{WithRateLimit(opts)})
+		assert.Error(t, err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3", now))
+	assert.Equal(t, 5*time.Second, parseRetryAfter(now.Add(5*time.Second).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
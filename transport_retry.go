@@ -0,0 +1,154 @@
+package passage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryMinBackoff  = 100 * time.Millisecond
+	defaultRetryMaxBackoff  = 5 * time.Second
+)
+
+// RetryOptions configures WithRetry and CallRetry. Zero-valued fields use their defaults.
+type RetryOptions struct {
+	// MaxAttempts is how many times a request is made at most, including the first attempt. Defaults to 3.
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound the randomized, exponentially growing wait between attempts. They default to
+	// 100 milliseconds and 5 seconds. A longer wait asked for by a Retry-After header is honored.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// WithRetry retries requests to the Passage API that fail with a network error, a 429 or a 5xx response. Only
+// requests with an idempotent method are retried. POST requests, such as those creating users and magic links, are
+// never retried, since a request whose response was lost may already have been processed.
+func WithRetry(opts RetryOptions) Option {
+	return func(cfg *config) error {
+		if opts.MaxAttempts < 0 || opts.MinBackoff < 0 || opts.MaxBackoff < 0 {
+			return errors.New("retry options must not be negative.")
+		}
+
+		if opts.MaxBackoff > 0 && opts.MinBackoff > opts.MaxBackoff {
+			return errors.New("MinBackoff must not be greater than MaxBackoff.")
+		}
+
+		cfg.retry = &opts
+		return nil
+	}
+}
+
+func (opts RetryOptions) withDefaults() RetryOptions {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultRetryMinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = max(defaultRetryMaxBackoff, opts.MinBackoff)
+	}
+
+	return opts
+}
+
+// backoff returns how long to wait before the given retry, counting from 1.
+func (opts RetryOptions) backoff(retry int) time.Duration {
+	ceiling := opts.MinBackoff << min(retry-1, 30)
+	if ceiling <= 0 || ceiling > opts.MaxBackoff {
+		ceiling = opts.MaxBackoff
+	}
+
+	if ceiling <= opts.MinBackoff {
+		return opts.MinBackoff
+	}
+
+	return opts.MinBackoff + rand.N(ceiling-opts.MinBackoff)
+}
+
+// withRetry retries failed requests as configured by defaults, or by the request's CallRetry option.
+func withRetry(next http.RoundTripper, defaults *RetryOptions) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		opts := defaults
+		if override := callOptionsFrom(req.Context()).retry; override != nil {
+			opts = override
+		}
+
+		if opts == nil || !retryable(req) {
+			return next.RoundTrip(req)
+		}
+
+		retry := opts.withDefaults()
+		for attempt := 1; ; attempt++ {
+			attemptReq := req
+			if attempt > 1 {
+				var err error
+				if attemptReq, err = rewind(req); err != nil {
+					return nil, err
+				}
+			}
+
+			res, err := next.RoundTrip(attemptReq)
+			if attempt == retry.MaxAttempts || !shouldRetry(req.Context(), res, err) {
+				return res, err
+			}
+
+			wait := retry.backoff(attempt)
+			if res != nil {
+				wait = max(wait, parseRetryAfter(res.Header.Get("Retry-After"), time.Now()))
+				io.Copy(io.Discard, res.Body)
+				res.Body.Close()
+			}
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-req.Context().Done():
+				timer.Stop()
+				return nil, req.Context().Err()
+			case <-timer.C:
+			}
+		}
+	})
+}
+
+// retryable reports whether req may be sent more than once.
+func retryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func shouldRetry(ctx context.Context, res *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil && !errors.Is(err, ErrCircuitOpen)
+	}
+
+	return res.StatusCode == http.StatusTooManyRequests ||
+		(res.StatusCode >= 500 && res.StatusCode != http.StatusNotImplemented)
+}
+
+// rewind returns a copy of req with a fresh body.
+func rewind(req *http.Request) (*http.Request, error) {
+	rewound := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		rewound.Body = body
+	}
+
+	return rewound, nil
+}
@@ -0,0 +1,93 @@
+package passage
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fastRetry = RetryOptions{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+// failFirst responds with status to the first n requests and passes the rest to next. It counts every request.
+func failFirst(t *testing.T, n int32, status int, next http.Handler) (http.Handler, *atomic.Int32) {
+	var requests atomic.Int32
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= n {
+			writeJSON(t, w, status, N500Error{Code: InternalServerError, Error: "boom"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	}), &requests
+}
+
+func TestRetryRecoversFromServerErrors(t *testing.T) {
+	handler, requests := failFirst(t, 2, http.StatusServiceUnavailable, newFakeAPI(t, PassageUser{ID: "user-1"}))
+	u := newTestUser(t, handler, WithRetry(fastRetry))
+
+	user, err := u.Get("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", user.ID)
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	handler, requests := failFirst(t, 10, http.StatusBadGateway, newFakeAPI(t))
+	u := newTestUser(t, handler, WithRetry(fastRetry))
+
+	_, err := u.Get("user-1")
+
+	var passageErr PassageError
+	require.ErrorAs(t, err, &passageErr)
+	assert.Equal(t, http.StatusBadGateway, passageErr.StatusCode)
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestRetrySkipsNonIdempotentRequests(t *testing.T) {
+	api := newFakeAPI(t)
+	handler, requests := failFirst(t, 1, http.StatusServiceUnavailable, api)
+	u := newTestUser(t, handler, WithRetry(fastRetry))
+
+	_, err := u.Create(CreateUserArgs{Email: "a@example.com"})
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), requests.Load())
+
+	// an idempotency key doesn't make the request retryable
+	handler, requests = failFirst(t, 1, http.StatusServiceUnavailable, api)
+	u = newTestUser(t, handler, WithRetry(fastRetry))
+
+	_, err = u.Create(CreateUserArgs{Email: "b@example.com"}, CallIdempotencyKey("create-b"))
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), requests.Load())
+	assert.Equal(t, 0, api.count("create"))
+}
+
+func TestCallRetryOverridesClientRetry(t *testing.T) {
+	handler, requests := failFirst(t, 1, http.StatusServiceUnavailable, newFakeAPI(t, PassageUser{ID: "user-1"}))
+	u := newTestUser(t, handler)
+
+	_, err := u.Get("user-1", CallRetry(fastRetry))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+
+	handler, requests = failFirst(t, 1, http.StatusServiceUnavailable, newFakeAPI(t, PassageUser{ID: "user-1"}))
+	u = newTestUser(t, handler, WithRetry(fastRetry))
+
+	_, err = u.Get("user-1", CallRetry(RetryOptions{MaxAttempts: 1}))
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestRetryBackoffStaysWithinBounds(t *testing.T) {
+	opts := RetryOptions{MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}.withDefaults()
+
+	for retry := 1; retry <= 40; retry++ {
+		backoff := opts.backoff(retry)
+		assert.GreaterOrEqual(t, backoff, opts.MinBackoff)
+		assert.LessOrEqual(t, backoff, opts.MaxBackoff)
+	}
+}
@@ -0,0 +1,139 @@
+package passage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hang blocks until the test ends or the client gives up on the request.
+func hang(t *testing.T) func(r *http.Request) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+
+	return func(r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}
+}
+
+func TestRequestTimeoutWithHungServer(t *testing.T) {
+	wait := hang(t)
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wait(r)
+	}), WithHTTPOptions(HTTPOptions{Timeout: 100 * time.Millisecond}))
+
+	start := time.Now()
+	_, err := u.Get("user-1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestRequestTimeoutIncludesReadingBody(t *testing.T) {
+	wait := hang(t)
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"user":`))
+		w.(http.Flusher).Flush()
+		wait(r)
+	}), WithHTTPOptions(HTTPOptions{Timeout: 100 * time.Millisecond}))
+
+	start := time.Now()
+	_, err := u.Get("user-1")
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	wait := hang(t)
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wait(r)
+	}), WithHTTPOptions(HTTPOptions{ResponseHeaderTimeout: 100 * time.Millisecond, Timeout: time.Minute}))
+
+	start := time.Now()
+	_, err := u.Get("user-1")
+	assert.ErrorContains(t, err, "timeout awaiting response headers")
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestJWKSTimeoutWithHungServer(t *testing.T) {
+	wait := hang(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wait(r)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg, err := newConfig([]Option{
+		WithHTTPOptions(HTTPOptions{JWKSTimeout: 100 * time.Millisecond}),
+		withJWKSURL(server.URL),
+	})
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = newAuth(testAppID, nil, nil, cfg)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestNewAuthFetchesJWKS(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	key, err := jwk.Import(privateKey.Public())
+	require.NoError(t, err)
+	require.NoError(t, key.Set(jwk.KeyIDKey, "test-kid"))
+	require.NoError(t, key.Set(jwk.AlgorithmKey, "RS256"))
+
+	set := jwk.NewSet()
+	require.NoError(t, set.AddKey(key))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(set))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg, err := newConfig([]Option{withJWKSURL(server.URL)})
+	require.NoError(t, err)
+
+	auth, err := newAuth(testAppID, nil, nil, cfg)
+	require.NoError(t, err)
+
+	signer := &testSigner{t: t, key: privateKey}
+	userID, err := auth.ValidateJWT(signer.sign("user-1", time.Now()))
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", userID)
+}
+
+// withJWKSURL is an Option that fetches the app's JWKS from url instead of from Passage.
+func withJWKSURL(url string) Option {
+	return func(cfg *config) error {
+		cfg.jwksURL = url
+		return nil
+	}
+}
+
+func TestHTTPOptionsDefaults(t *testing.T) {
+	opts := HTTPOptions{Timeout: time.Second}.withDefaults()
+
+	assert.Equal(t, time.Second, opts.Timeout)
+	assert.Equal(t, defaultDialTimeout, opts.DialTimeout)
+	assert.Equal(t, defaultJWKSTimeout, opts.JWKSTimeout)
+	assert.Equal(t, defaultMaxIdleConnsPerHost, opts.MaxIdleConnsPerHost)
+	assert.Equal(t, 0, opts.MaxConnsPerHost)
+
+	_, err := newConfig([]Option{WithHTTPOptions(HTTPOptions{Timeout: -time.Second})})
+	assert.Error(t, err)
+}
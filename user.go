@@ -3,29 +3,145 @@ package passage
 import (
 	"context"
 	"errors"
+	"maps"
 	"net/http"
+	"slices"
 	"strings"
 )
 
 type User struct {
-	appID  string
-	client *ClientWithResponses
+	appID       string
+	client      *ClientWithResponses
+	cache       *userCache
+	revocations RevocationStore
+	// statusCheck is the user status check of the Auth sharing this User, if any.
+	statusCheck *userStatusCheck
+	// dryRun, when set, makes every mutating operation a dry run whose changes are passed to it.
+	dryRun func(UserChange)
+	// metadataRules, when set, restrict the user metadata accepted before a request is sent.
+	metadataRules *MetadataRules
+
+	// getCalls collapses concurrent Get calls for the same user ID into one request, unless their call options
+	// change the request.
+	getCalls flightGroup[*PassageUser]
 }
 
-func newUser(appID string, client *ClientWithResponses) *User {
+func newUser(appID string, client *ClientWithResponses, cfg config) *User {
 	return &User{
-		appID:  appID,
-		client: client,
+		appID:         appID,
+		client:        client,
+		cache:         cfg.userCache,
+		revocations:   cfg.revocations,
+		dryRun:        cfg.dryRun,
+		metadataRules: cfg.metadataRules,
 	}
 }
 
 // Get retrieves a user's object using their user ID.
-func (u *User) Get(userID string) (*PassageUser, error) {
+func (u *User) Get(userID string, opts ...CallOption) (*PassageUser, error) {
+	return u.get(WithCallOptions(context.Background(), opts...), userID)
+}
+
+func (u *User) get(ctx context.Context, userID string) (*PassageUser, error) {
 	if userID == "" {
 		return nil, errors.New("userID is required.")
 	}
 
-	res, err := u.client.GetUserWithResponse(context.Background(), u.appID, userID)
+	if u.cache != nil {
+		return u.cachedGet(ctx, userID)
+	}
+
+	return u.getUncached(ctx, userID)
+}
+
+// getUncached retrieves a user from the API, bypassing the user cache.
+func (u *User) getUncached(ctx context.Context, userID string) (*PassageUser, error) {
+	// a call whose options change its request, such as its headers or timeout, can't share another call's request
+	if callOptionsFrom(ctx).changeRequests() {
+		return u.fetch(ctx, userID)
+	}
+
+	user, err := u.getCalls.do(ctx, userID, func(ctx context.Context) (*PassageUser, error) {
+		return u.fetch(ctx, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// callers sharing a request each get their own copy
+	return cloneUser(user), nil
+}
+
+// cloneUser returns a deep copy of user, sharing no maps, slices or pointers with it.
+func cloneUser(user *PassageUser) *PassageUser {
+	clone := *user
+	clone.UserMetadata = cloneMetadata(user.UserMetadata)
+	clone.WebauthnTypes = slices.Clone(user.WebauthnTypes)
+
+	if user.RecentEvents != nil {
+		clone.RecentEvents = make([]UserRecentEvent, len(user.RecentEvents))
+		for i, event := range user.RecentEvents {
+			event.CompletedAt = clonePointer(event.CompletedAt)
+			event.SocialLoginType = clonePointer(event.SocialLoginType)
+			clone.RecentEvents[i] = event
+		}
+	}
+
+	if user.WebauthnDevices != nil {
+		clone.WebauthnDevices = make([]WebAuthnDevices, len(user.WebauthnDevices))
+		for i, device := range user.WebauthnDevices {
+			device.Icons.Dark = clonePointer(device.Icons.Dark)
+			device.Icons.Light = clonePointer(device.Icons.Light)
+			clone.WebauthnDevices[i] = device
+		}
+	}
+
+	clone.SocialConnections.Apple = clonePointer(user.SocialConnections.Apple)
+	clone.SocialConnections.Github = clonePointer(user.SocialConnections.Github)
+	clone.SocialConnections.Google = clonePointer(user.SocialConnections.Google)
+
+	return &clone
+}
+
+func cloneMetadata(metadata map[string]interface{}) map[string]interface{} {
+	if metadata == nil {
+		return nil
+	}
+
+	clone := make(map[string]interface{}, len(metadata))
+	for key, value := range metadata {
+		clone[key] = cloneMetadataValue(value)
+	}
+
+	return clone
+}
+
+func cloneMetadataValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return cloneMetadata(value)
+	case []interface{}:
+		clone := make([]interface{}, len(value))
+		for i, item := range value {
+			clone[i] = cloneMetadataValue(item)
+		}
+		return clone
+	default:
+		return value
+	}
+}
+
+func clonePointer[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+
+	clone := *p
+	return &clone
+}
+
+func (u *User) fetch(ctx context.Context, userID string) (*PassageUser, error) {
+	res, err := u.client.GetUserWithResponse(ctx, u.appID, userID, requestEditors(ctx)...)
 	if err != nil {
 		return nil, err
 	}
@@ -34,24 +150,37 @@ func (u *User) Get(userID string) (*PassageUser, error) {
 		return &res.JSON200.PassageUser, nil
 	}
 
-	return nil, errorFromResponse(res.Body, res.StatusCode())
+	return nil, errorFromResponse(res.HTTPResponse, res.Body)
 }
 
 // GetByIdentifier retrieves a user's object using their user identifier.
-func (u *User) GetByIdentifier(identifier string) (*PassageUser, error) {
+func (u *User) GetByIdentifier(identifier string, opts ...CallOption) (*PassageUser, error) {
+	return u.getByIdentifier(WithCallOptions(context.Background(), opts...), identifier)
+}
+
+func (u *User) getByIdentifier(ctx context.Context, identifier string) (*PassageUser, error) {
 	if identifier == "" {
 		return nil, errors.New("identifier is required.")
 	}
 
+	if u.cache != nil {
+		return u.cachedGetByIdentifier(ctx, identifier)
+	}
+
+	return u.findByIdentifier(ctx, identifier)
+}
+
+func (u *User) findByIdentifier(ctx context.Context, identifier string) (*PassageUser, error) {
 	limit := 1
 	lowerIdentifier := strings.ToLower(identifier)
 	res, err := u.client.ListPaginatedUsersWithResponse(
-		context.Background(),
+		ctx,
 		u.appID,
 		&ListPaginatedUsersParams{
 			Limit:      &limit,
 			Identifier: &lowerIdentifier,
 		},
+		requestEditors(ctx)...,
 	)
 
 	if err != nil {
@@ -66,112 +195,191 @@ func (u *User) GetByIdentifier(identifier string) (*PassageUser, error) {
 				Message:    "Could not find user with that identifier.",
 				ErrorCode:  "user_not_found",
 				StatusCode: http.StatusNotFound,
+				RequestID:  requestIDOf(res.HTTPResponse.Header),
 			}
 		}
 
-		return u.Get(users[0].ID)
+		return u.get(ctx, users[0].ID)
 	}
 
-	return nil, errorFromResponse(res.Body, res.StatusCode())
+	return nil, errorFromResponse(res.HTTPResponse, res.Body)
 }
 
 // Activate activates a user using their user ID.
-func (u *User) Activate(userID string) (*PassageUser, error) {
+func (u *User) Activate(userID string, opts ...CallOption) (*PassageUser, error) {
+	return u.activate(WithCallOptions(context.Background(), opts...), userID)
+}
+
+func (u *User) activate(ctx context.Context, userID string) (*PassageUser, error) {
 	if userID == "" {
 		return nil, errors.New("userID is required.")
 	}
 
-	res, err := u.client.ActivateUserWithResponse(context.Background(), u.appID, userID)
+	if u.isDryRun(ctx) {
+		return u.dryRunChange(ctx, OperationActivateUser, userID, func(user *PassageUser) {
+			user.Status = StatusActive
+		})
+	}
+
+	res, err := u.client.ActivateUserWithResponse(ctx, u.appID, userID, requestEditors(ctx)...)
 	if err != nil {
 		return nil, err
 	}
 
 	if res.JSON200 != nil {
+		u.invalidate(ctx, userID, &res.JSON200.PassageUser)
 		return &res.JSON200.PassageUser, nil
 	}
 
-	return nil, errorFromResponse(res.Body, res.StatusCode())
+	return nil, errorFromResponse(res.HTTPResponse, res.Body)
+}
+
+// Deactivate deactivates a user using their user ID. If the revocation of their access tokens can't be recorded
+// in the RevocationStore, the deactivated user is returned with an error wrapping ErrRevocationNotRecorded.
+func (u *User) Deactivate(userID string, opts ...CallOption) (*PassageUser, error) {
+	return u.deactivate(WithCallOptions(context.Background(), opts...), userID)
 }
 
-// Deactivate deactivates a user using their user ID.
-func (u *User) Deactivate(userID string) (*PassageUser, error) {
+func (u *User) deactivate(ctx context.Context, userID string) (*PassageUser, error) {
 	if userID == "" {
 		return nil, errors.New("userID is required.")
 	}
 
-	res, err := u.client.DeactivateUserWithResponse(context.Background(), u.appID, userID)
+	if u.isDryRun(ctx) {
+		return u.dryRunChange(ctx, OperationDeactivateUser, userID, func(user *PassageUser) {
+			user.Status = StatusInactive
+		})
+	}
+
+	res, err := u.client.DeactivateUserWithResponse(ctx, u.appID, userID, requestEditors(ctx)...)
 	if err != nil {
 		return nil, err
 	}
 
 	if res.JSON200 != nil {
-		return &res.JSON200.PassageUser, nil
+		u.invalidate(ctx, userID, &res.JSON200.PassageUser)
+		// the user is returned even if the revocation wasn't recorded, since they were deactivated
+		return &res.JSON200.PassageUser, u.recordRevocation(ctx, userID)
 	}
 
-	return nil, errorFromResponse(res.Body, res.StatusCode())
+	return nil, errorFromResponse(res.HTTPResponse, res.Body)
 }
 
 // Update updates a user.
-func (u *User) Update(userID string, options UpdateUserOptions) (*PassageUser, error) {
+func (u *User) Update(userID string, options UpdateUserOptions, opts ...CallOption) (*PassageUser, error) {
+	return u.update(WithCallOptions(context.Background(), opts...), userID, options)
+}
+
+func (u *User) update(ctx context.Context, userID string, options UpdateUserOptions) (*PassageUser, error) {
 	if userID == "" {
 		return nil, errors.New("userID is required.")
 	}
 
-	res, err := u.client.UpdateUserWithResponse(context.Background(), u.appID, userID, options)
+	options, err := validateUpdateUserOptions(options, u.metadataRules)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.isDryRun(ctx) {
+		return u.dryRunChange(ctx, OperationUpdateUser, userID, func(user *PassageUser) {
+			if options.Email != "" {
+				user.Email = options.Email
+			}
+			if options.Phone != "" {
+				user.Phone = options.Phone
+			}
+			if len(options.UserMetadata) > 0 {
+				user.UserMetadata = maps.Clone(options.UserMetadata)
+			}
+		})
+	}
+
+	res, err := u.client.UpdateUserWithResponse(ctx, u.appID, userID, options, requestEditors(ctx)...)
 	if err != nil {
 		return nil, err
 	}
 
 	if res.JSON200 != nil {
+		u.invalidate(ctx, userID, &res.JSON200.PassageUser)
 		return &res.JSON200.PassageUser, nil
 	}
 
-	return nil, errorFromResponse(res.Body, res.StatusCode())
+	return nil, errorFromResponse(res.HTTPResponse, res.Body)
 }
 
 // Create creates a user.
-func (u *User) Create(args CreateUserArgs) (*PassageUser, error) {
-	if args.Email == "" && args.Phone == "" {
-		return nil, errors.New("At least one of args.Email or args.Phone is required.")
+func (u *User) Create(args CreateUserArgs, opts ...CallOption) (*PassageUser, error) {
+	return u.create(WithCallOptions(context.Background(), opts...), args)
+}
+
+func (u *User) create(ctx context.Context, args CreateUserArgs) (*PassageUser, error) {
+	args, err := validateCreateUserArgs(args, u.metadataRules)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.isDryRun(ctx) {
+		return u.dryRunCreate(ctx, args)
 	}
 
-	res, err := u.client.CreateUserWithResponse(context.Background(), u.appID, args)
+	res, err := u.client.CreateUserWithResponse(ctx, u.appID, args, requestEditors(ctx)...)
 	if err != nil {
 		return nil, err
 	}
 
 	if res.JSON201 != nil {
+		u.invalidate(ctx, res.JSON201.PassageUser.ID, &res.JSON201.PassageUser)
 		return &res.JSON201.PassageUser, nil
 	}
 
-	return nil, errorFromResponse(res.Body, res.StatusCode())
+	err = errorFromResponse(res.HTTPResponse, res.Body)
+	if isUserExistsError(err) {
+		// another user has the email or phone number, so a cached "not found" for them is stale
+		u.forgetIdentifiers(ctx, args.Email, args.Phone)
+	}
+
+	return nil, err
 }
 
-// Delete deletes a user using their user ID.
-func (u *User) Delete(userID string) error {
+// Delete deletes a user using their user ID. An error wrapping ErrRevocationNotRecorded means the user was
+// deleted but the revocation of their access tokens couldn't be recorded.
+func (u *User) Delete(userID string, opts ...CallOption) error {
+	return u.delete(WithCallOptions(context.Background(), opts...), userID)
+}
+
+func (u *User) delete(ctx context.Context, userID string) error {
 	if userID == "" {
 		return errors.New("userID is required.")
 	}
 
-	res, err := u.client.DeleteUserWithResponse(context.Background(), u.appID, userID)
+	if u.isDryRun(ctx) {
+		return u.dryRunDelete(ctx, userID)
+	}
+
+	res, err := u.client.DeleteUserWithResponse(ctx, u.appID, userID, requestEditors(ctx)...)
 	if err != nil {
 		return err
 	}
 
 	if res.StatusCode() >= 200 && res.StatusCode() < 300 {
-		return nil
+		u.invalidate(ctx, userID, nil)
+		return u.recordRevocation(ctx, userID)
 	}
 
-	return errorFromResponse(res.Body, res.StatusCode())
+	return errorFromResponse(res.HTTPResponse, res.Body)
 }
 
 // ListDevices retrieves a user's webauthn devices using their user ID.
-func (u *User) ListDevices(userID string) ([]WebAuthnDevices, error) {
+func (u *User) ListDevices(userID string, opts ...CallOption) ([]WebAuthnDevices, error) {
+	return u.listDevices(WithCallOptions(context.Background(), opts...), userID)
+}
+
+func (u *User) listDevices(ctx context.Context, userID string) ([]WebAuthnDevices, error) {
 	if userID == "" {
 		return nil, errors.New("userID is required.")
 	}
 
-	res, err := u.client.ListUserDevicesWithResponse(context.Background(), u.appID, userID)
+	res, err := u.client.ListUserDevicesWithResponse(ctx, u.appID, userID, requestEditors(ctx)...)
 	if err != nil {
 		return nil, err
 	}
@@ -180,11 +388,15 @@ func (u *User) ListDevices(userID string) ([]WebAuthnDevices, error) {
 		return res.JSON200.Devices, nil
 	}
 
-	return nil, errorFromResponse(res.Body, res.StatusCode())
+	return nil, errorFromResponse(res.HTTPResponse, res.Body)
 }
 
 // RevokeDevice revokes user's webauthn device using their user ID and the device ID.
-func (u *User) RevokeDevice(userID string, deviceID string) error {
+func (u *User) RevokeDevice(userID string, deviceID string, opts ...CallOption) error {
+	return u.revokeDevice(WithCallOptions(context.Background(), opts...), userID, deviceID)
+}
+
+func (u *User) revokeDevice(ctx context.Context, userID string, deviceID string) error {
 	if userID == "" {
 		return errors.New("userID is required.")
 	}
@@ -193,32 +405,47 @@ func (u *User) RevokeDevice(userID string, deviceID string) error {
 		return errors.New("deviceID is required.")
 	}
 
-	res, err := u.client.DeleteUserDevicesWithResponse(context.Background(), u.appID, userID, deviceID)
+	if u.isDryRun(ctx) {
+		return u.dryRunRevokeDevice(ctx, userID, deviceID)
+	}
+
+	res, err := u.client.DeleteUserDevicesWithResponse(ctx, u.appID, userID, deviceID, requestEditors(ctx)...)
 	if err != nil {
 		return err
 	}
 
 	if res.StatusCode() >= 200 && res.StatusCode() < 300 {
+		u.invalidate(ctx, userID, nil)
 		return nil
 	}
 
-	return errorFromResponse(res.Body, res.StatusCode())
+	return errorFromResponse(res.HTTPResponse, res.Body)
 }
 
-// RevokeRefreshTokens revokes all of a user's Refresh Tokens using their User ID.
-func (u *User) RevokeRefreshTokens(userID string) error {
+// RevokeRefreshTokens revokes all of a user's Refresh Tokens using their User ID. An error wrapping
+// ErrRevocationNotRecorded means the tokens were revoked but the revocation of access tokens couldn't be recorded.
+func (u *User) RevokeRefreshTokens(userID string, opts ...CallOption) error {
+	return u.revokeRefreshTokens(WithCallOptions(context.Background(), opts...), userID)
+}
+
+func (u *User) revokeRefreshTokens(ctx context.Context, userID string) error {
 	if userID == "" {
 		return errors.New("userID is required.")
 	}
 
-	res, err := u.client.RevokeUserRefreshTokensWithResponse(context.Background(), u.appID, userID)
+	if u.isDryRun(ctx) {
+		_, err := u.dryRunChange(ctx, OperationRevokeUserRefreshTokens, userID, func(*PassageUser) {})
+		return err
+	}
+
+	res, err := u.client.RevokeUserRefreshTokensWithResponse(ctx, u.appID, userID, requestEditors(ctx)...)
 	if err != nil {
 		return err
 	}
 
 	if res.StatusCode() >= 200 && res.StatusCode() < 300 {
-		return nil
+		return u.recordRevocation(ctx, userID)
 	}
 
-	return errorFromResponse(res.Body, res.StatusCode())
+	return errorFromResponse(res.HTTPResponse, res.Body)
 }
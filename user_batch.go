@@ -0,0 +1,71 @@
+package passage
+
+import (
+	"context"
+	"sync"
+)
+
+const defaultGetManyConcurrency = 10
+
+// GetManyOptions configures GetMany.
+type GetManyOptions struct {
+	// Concurrency is the maximum number of requests in flight at once. Defaults to 10.
+	Concurrency int
+}
+
+// GetMany retrieves the users with the given IDs in parallel. Duplicate IDs are fetched once.
+// It returns the users that were found keyed by ID, and the error for every ID that could not be fetched.
+func (u *User) GetMany(
+	ctx context.Context,
+	userIDs []string,
+	opts *GetManyOptions,
+) (map[string]*PassageUser, map[string]error) {
+	concurrency := defaultGetManyConcurrency
+	if opts != nil && opts.Concurrency > 0 {
+		concurrency = opts.Concurrency
+	}
+
+	users := map[string]*PassageUser{}
+	errs := map[string]error{}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	seen := map[string]bool{}
+
+	for _, userID := range userIDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			mu.Lock()
+			errs[userID] = ctx.Err()
+			mu.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			user, err := u.get(ctx, userID)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[userID] = err
+			} else {
+				users[userID] = user
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return users, errs
+}
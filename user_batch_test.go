@@ -0,0 +1,166 @@
+package passage
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMany(t *testing.T) {
+	api := newFakeAPI(t,
+		PassageUser{ID: "user-1"},
+		PassageUser{ID: "user-2"},
+		PassageUser{ID: "user-3"},
+	)
+	u := newTestUser(t, api)
+
+	users, errs := u.GetMany(context.Background(), []string{"user-1", "user-2", "user-1", "missing", "user-3"}, nil)
+
+	assert.Len(t, users, 3)
+	assert.Equal(t, "user-2", users["user-2"].ID)
+	require.Len(t, errs, 1)
+	assert.True(t, isNotFoundError(errs["missing"]))
+	assert.Equal(t, 4, api.count("get"))
+}
+
+func TestGetManyRespectsConcurrency(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	api := newFakeAPI(t)
+	ids := []string{}
+	for _, id := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		api.add(PassageUser{ID: id})
+		ids = append(ids, id)
+	}
+
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			previous := maxInFlight.Load()
+			if current <= previous || maxInFlight.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		api.ServeHTTP(w, r)
+	}))
+
+	users, errs := u.GetMany(context.Background(), ids, &GetManyOptions{Concurrency: 3})
+	assert.Len(t, users, len(ids))
+	assert.Empty(t, errs)
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(3))
+}
+
+func TestGetCollapsesConcurrentCalls(t *testing.T) {
+	api := newFakeAPI(t, PassageUser{ID: "user-1", Email: "user@example.com"})
+	release := make(chan struct{})
+
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		api.ServeHTTP(w, r)
+	}))
+
+	callers := 5
+	var wg sync.WaitGroup
+	wg.Add(callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			defer wg.Done()
+			user, err := u.Get("user-1")
+			assert.NoError(t, err)
+			assert.Equal(t, "user@example.com", user.Email)
+		}()
+	}
+
+	// give every caller time to join the in-flight request before it completes
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, 1, api.count("get"))
+}
+
+func TestGetDoesNotShareRequestsOfCallsWithOptions(t *testing.T) {
+	api := newFakeAPI(t, PassageUser{ID: "user-1", Email: "user@example.com"})
+	release := make(chan struct{})
+
+	var tagged atomic.Int32
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Tag") == "b" {
+			tagged.Add(1)
+		}
+		<-release
+		api.ServeHTTP(w, r)
+	}))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, err := u.Get("user-1")
+		assert.NoError(t, err)
+	}()
+	go func() {
+		defer wg.Done()
+		// joins the first call's request if it is shared
+		time.Sleep(20 * time.Millisecond)
+		_, err := u.Get("user-1", CallHeader("X-Tag", "b"))
+		assert.NoError(t, err)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, 2, api.count("get"))
+	assert.Equal(t, int32(1), tagged.Load())
+}
+
+func TestGetStopsWaitingWhenContextIsDone(t *testing.T) {
+	release := make(chan struct{})
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	// registered after the server so the handler is released before the server is closed
+	t.Cleanup(func() { close(release) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := u.get(ctx, "user-1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestCloneUserSharesNothing(t *testing.T) {
+	light := "light.svg"
+	completed := time.Unix(100, 0)
+	user := &PassageUser{
+		ID:                "user-1",
+		UserMetadata:      map[string]interface{}{"profile": map[string]interface{}{"tags": []interface{}{"a"}}},
+		RecentEvents:      []UserRecentEvent{{ID: "event-1", CompletedAt: &completed}},
+		SocialConnections: UserSocialConnections{Github: &GithubUserSocialConnection{ProviderID: "gh-1"}},
+		WebauthnDevices:   []WebAuthnDevices{{ID: "device-1", Icons: WebAuthnIcons{Light: &light}}},
+		WebauthnTypes:     []WebAuthnType{"passkey"},
+	}
+
+	clone := cloneUser(user)
+	require.Equal(t, user, clone)
+
+	clone.UserMetadata["profile"].(map[string]interface{})["tags"].([]interface{})[0] = "b"
+	*clone.RecentEvents[0].CompletedAt = time.Unix(200, 0)
+	clone.SocialConnections.Github.ProviderID = "gh-2"
+	*clone.WebauthnDevices[0].Icons.Light = "dark.svg"
+	clone.WebauthnTypes[0] = "platform"
+
+	assert.Equal(t, "a", user.UserMetadata["profile"].(map[string]interface{})["tags"].([]interface{})[0])
+	assert.Equal(t, time.Unix(100, 0), *user.RecentEvents[0].CompletedAt)
+	assert.Equal(t, "gh-1", user.SocialConnections.Github.ProviderID)
+	assert.Equal(t, "light.svg", *user.WebauthnDevices[0].Icons.Light)
+	assert.Equal(t, WebAuthnType("passkey"), user.WebauthnTypes[0])
+}
@@ -0,0 +1,124 @@
+package passage
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+const listUsersPageSize = 500
+
+// UserQuery selects users for operations that act on many users at once. Zero-valued fields match every user.
+type UserQuery struct {
+	// CreatedBefore matches users created before this time.
+	CreatedBefore time.Time
+	// CreatedAfter matches users created after this time.
+	CreatedAfter time.Time
+	// Status matches users with this status.
+	Status UserStatus
+	// IdentifierDomain matches users whose email address is at this domain, such as "example.com".
+	IdentifierDomain string
+	// Filter, when set, matches users for which it returns true.
+	Filter func(user ListPaginatedUsersItem) bool
+}
+
+func (q UserQuery) matches(user ListPaginatedUsersItem) bool {
+	if !q.CreatedBefore.IsZero() && !user.CreatedAt.Before(q.CreatedBefore) {
+		return false
+	}
+
+	if !q.CreatedAfter.IsZero() && !user.CreatedAt.After(q.CreatedAfter) {
+		return false
+	}
+
+	if q.Status != "" && user.Status != q.Status {
+		return false
+	}
+
+	if q.IdentifierDomain != "" {
+		_, domain, ok := strings.Cut(user.Email, "@")
+		if !ok || !strings.EqualFold(domain, strings.TrimPrefix(q.IdentifierDomain, "@")) {
+			return false
+		}
+	}
+
+	return q.Filter == nil || q.Filter(user)
+}
+
+// listUsers calls fn for every user matching query, following pagination. Pages are anchored to the time the
+// listing started so users created meanwhile don't shift results between pages.
+func (u *User) listUsers(ctx context.Context, query UserQuery, fn func(user ListPaginatedUsersItem) error) error {
+	anchor := query.CreatedBefore
+	if anchor.IsZero() {
+		anchor = time.Now()
+	}
+
+	createdBefore := int(anchor.Unix())
+	limit := listUsersPageSize
+	params := &ListPaginatedUsersParams{
+		Limit:         &limit,
+		CreatedBefore: &createdBefore,
+	}
+
+	if query.Status != "" {
+		status := string(query.Status)
+		params.Status = &status
+	}
+
+	for page := 1; ; page++ {
+		params.Page = &page
+
+		res, err := u.client.ListPaginatedUsersWithResponse(ctx, u.appID, params, requestEditors(ctx)...)
+		if err != nil {
+			return err
+		}
+
+		if res.JSON200 == nil {
+			return errorFromResponse(res.HTTPResponse, res.Body)
+		}
+
+		for _, user := range res.JSON200.Users {
+			if !query.matches(user) {
+				continue
+			}
+
+			if err := fn(user); err != nil {
+				return err
+			}
+		}
+
+		if len(res.JSON200.Users) < limit {
+			return nil
+		}
+	}
+}
+
+func (u *User) listUserIDs(ctx context.Context, query UserQuery) ([]string, error) {
+	ids := []string{}
+	err := u.listUsers(ctx, query, func(user ListPaginatedUsersItem) error {
+		ids = append(ids, user.ID)
+		return nil
+	})
+
+	return ids, err
+}
+
+// RevokeRefreshTokensWhere revokes the refresh tokens of every user matching query, for example to log out many
+// users at once during incident response. Failures for individual users are collected in the report rather than
+// stopping the operation; the returned error is only set if the matching users could not be listed. Under WithDryRun
+// or CallDryRun, the report is a dry run like one asked for with BulkOptions.DryRun.
+func (u *User) RevokeRefreshTokensWhere(ctx context.Context, query UserQuery, opts *BulkOptions) (*BulkReport, error) {
+	ids, err := u.listUserIDs(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	report := runBulk(ctx, ids, opts, u.revokeRefreshTokens)
+	if u.isDryRun(ctx) {
+		// each revocation was a dry run that reported its change, so none succeeded
+		report.DryRun = true
+		report.Succeeded = []string{}
+	}
+
+	return report, nil
+}
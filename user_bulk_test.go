@@ -0,0 +1,93 @@
+package passage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBulkTestAPI(t *testing.T) *fakeAPI {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	return newFakeAPI(t,
+		PassageUser{ID: "user-1", Email: "a@corp.example", Status: StatusActive, CreatedAt: created},
+		PassageUser{ID: "user-2", Email: "b@corp.example", Status: StatusInactive, CreatedAt: created},
+		PassageUser{ID: "user-3", Email: "c@other.example", Status: StatusActive, CreatedAt: created},
+		PassageUser{ID: "user-4", Email: "d@CORP.example", Status: StatusActive, CreatedAt: created.AddDate(1, 0, 0)},
+	)
+}
+
+func TestRevokeRefreshTokensWhereDryRun(t *testing.T) {
+	api := newBulkTestAPI(t)
+	u := newTestUser(t, api)
+
+	report, err := u.RevokeRefreshTokensWhere(context.Background(), UserQuery{
+		Status:           StatusActive,
+		IdentifierDomain: "corp.example",
+	}, &BulkOptions{DryRun: true})
+	require.NoError(t, err)
+
+	assert.True(t, report.DryRun)
+	assert.ElementsMatch(t, []string{"user-1", "user-4"}, report.Matched)
+	assert.Empty(t, report.Succeeded)
+	assert.Equal(t, 0, api.count("revoke_tokens"))
+}
+
+func TestRevokeRefreshTokensWhereReportsFailures(t *testing.T) {
+	api := newBulkTestAPI(t)
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/users/user-3/tokens") {
+			writeJSON(t, w, http.StatusInternalServerError, N500Error{Code: InternalServerError, Error: "boom"})
+			return
+		}
+		api.ServeHTTP(w, r)
+	}))
+
+	report, err := u.RevokeRefreshTokensWhere(context.Background(), UserQuery{
+		CreatedBefore: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+	}, &BulkOptions{Concurrency: 2, RateLimit: 1000})
+	require.NoError(t, err)
+
+	sort.Strings(report.Succeeded)
+	assert.Equal(t, []string{"user-1", "user-2"}, report.Succeeded)
+	require.Contains(t, report.Failed, "user-3")
+
+	var passageErr PassageError
+	require.ErrorAs(t, report.Failed["user-3"], &passageErr)
+	assert.Equal(t, http.StatusInternalServerError, passageErr.StatusCode)
+	assert.Equal(t, 2, api.count("revoke_tokens"))
+}
+
+func TestListUsersFollowsPagination(t *testing.T) {
+	api := newFakeAPI(t)
+	for i := 0; i < listUsersPageSize+3; i++ {
+		api.add(PassageUser{ID: fmt.Sprintf("user-%04d", i), Status: StatusActive})
+	}
+	u := newTestUser(t, api)
+
+	ids, err := u.listUserIDs(context.Background(), UserQuery{})
+	require.NoError(t, err)
+	assert.Len(t, ids, listUsersPageSize+3)
+	assert.Equal(t, 2, api.count("list"))
+}
+
+func TestTokenBucketSpacesOutRequests(t *testing.T) {
+	now := time.Unix(0, 0)
+	bucket := newTokenBucket(2, 2)
+	bucket.now = func() time.Time { return now }
+
+	assert.Equal(t, time.Duration(0), bucket.reserve())
+	assert.Equal(t, time.Duration(0), bucket.reserve())
+	assert.Equal(t, 500*time.Millisecond, bucket.reserve())
+	assert.Equal(t, time.Second, bucket.reserve())
+
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, time.Duration(0), bucket.reserve())
+}
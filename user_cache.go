@@ -0,0 +1,194 @@
+package passage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultUserCacheTTL = time.Minute
+
+// UserCacheOptions configures the user cache enabled by WithUserCache.
+type UserCacheOptions struct {
+	// TTL is how long a user is cached. Defaults to one minute.
+	TTL time.Duration
+	// NotFoundTTL is how long a lookup that found no user is cached. Not-found results are not cached when it is 0.
+	NotFoundTTL time.Duration
+}
+
+type userCache struct {
+	cache       Cache
+	ttl         time.Duration
+	notFoundTTL time.Duration
+}
+
+// cachedUser is the value stored in the cache. User ID keys hold User, identifier keys hold UserID,
+// and either kind holds Err when the lookup found no user.
+type cachedUser struct {
+	User   *PassageUser  `json:"user,omitempty"`
+	UserID string        `json:"user_id,omitempty"`
+	Err    *PassageError `json:"error,omitempty"`
+}
+
+func newUserCache(cache Cache, opts *UserCacheOptions) *userCache {
+	c := &userCache{
+		cache: cache,
+		ttl:   defaultUserCacheTTL,
+	}
+
+	if opts != nil {
+		if opts.TTL > 0 {
+			c.ttl = opts.TTL
+		}
+		c.notFoundTTL = opts.NotFoundTTL
+	}
+
+	return c
+}
+
+func userIDCacheKey(appID string, userID string) string {
+	return fmt.Sprintf("passage:%s:user:id:%s", appID, userID)
+}
+
+func identifierCacheKey(appID string, identifier string) string {
+	return fmt.Sprintf("passage:%s:user:identifier:%s", appID, strings.ToLower(identifier))
+}
+
+// lookup returns the cached entry for key. Cache errors are treated as misses, since the API remains the
+// source of truth.
+func (c *userCache) lookup(ctx context.Context, key string) (cachedUser, bool) {
+	var entry cachedUser
+
+	raw, ok, err := c.cache.Get(ctx, key)
+	if err != nil || !ok {
+		return entry, false
+	}
+
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return entry, false
+	}
+
+	return entry, true
+}
+
+// store caches the outcome of a lookup: entry on success, or a not-found marker if err is a 404.
+func (c *userCache) store(ctx context.Context, key string, entry cachedUser, err error) {
+	ttl := c.ttl
+
+	if err != nil {
+		var passageErr PassageError
+		if c.notFoundTTL <= 0 || !errors.As(err, &passageErr) || passageErr.StatusCode != http.StatusNotFound {
+			return
+		}
+
+		entry = cachedUser{Err: &passageErr}
+		ttl = c.notFoundTTL
+	}
+
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	_ = c.cache.Set(ctx, key, raw, ttl)
+}
+
+func (c *userCache) delete(ctx context.Context, keys ...string) {
+	_ = c.cache.Delete(ctx, keys...)
+}
+
+// invalidate drops the cached copy of a user, any not-found markers for their identifiers and the status the Auth
+// sharing this User cached for them, so a user who was activated or deactivated is checked again.
+func (u *User) invalidate(ctx context.Context, userID string, user *PassageUser) {
+	if u.statusCheck != nil {
+		_ = u.statusCheck.statuses.Delete(ctx, userID)
+	}
+
+	if u.cache == nil {
+		return
+	}
+
+	keys := []string{userIDCacheKey(u.appID, userID)}
+	if user != nil {
+		keys = append(keys, u.identifierKeys(user.Email, user.Phone)...)
+	}
+
+	u.cache.delete(ctx, keys...)
+}
+
+// forgetIdentifiers removes the cached lookups of identifiers, such as a "not found" made stale by a user created
+// elsewhere.
+func (u *User) forgetIdentifiers(ctx context.Context, identifiers ...string) {
+	if u.cache == nil {
+		return
+	}
+
+	u.cache.delete(ctx, u.identifierKeys(identifiers...)...)
+}
+
+func (u *User) identifierKeys(identifiers ...string) []string {
+	keys := []string{}
+	for _, identifier := range identifiers {
+		if identifier != "" {
+			keys = append(keys, identifierCacheKey(u.appID, identifier))
+		}
+	}
+
+	return keys
+}
+
+func (u *User) cachedGet(ctx context.Context, userID string) (*PassageUser, error) {
+	key := userIDCacheKey(u.appID, userID)
+
+	if entry, ok := u.cache.lookup(ctx, key); ok {
+		if entry.Err != nil {
+			return nil, *entry.Err
+		}
+
+		if entry.User != nil {
+			return entry.User, nil
+		}
+	}
+
+	user, err := u.getUncached(ctx, userID)
+	u.cache.store(ctx, key, cachedUser{User: user}, err)
+
+	return user, err
+}
+
+// cachedGetByIdentifier caches which user ID an identifier belongs to. The user itself is read through the
+// user ID cache, and the mapping is dropped if that user no longer has the identifier.
+func (u *User) cachedGetByIdentifier(ctx context.Context, identifier string) (*PassageUser, error) {
+	key := identifierCacheKey(u.appID, identifier)
+
+	if entry, ok := u.cache.lookup(ctx, key); ok {
+		if entry.Err != nil {
+			return nil, *entry.Err
+		}
+
+		user, err := u.get(ctx, entry.UserID)
+		if err == nil && hasIdentifier(user, identifier) {
+			return user, nil
+		}
+
+		u.cache.delete(ctx, key)
+	}
+
+	user, err := u.findByIdentifier(ctx, identifier)
+
+	entry := cachedUser{}
+	if user != nil {
+		entry.UserID = user.ID
+	}
+	u.cache.store(ctx, key, entry, err)
+
+	return user, err
+}
+
+func hasIdentifier(user *PassageUser, identifier string) bool {
+	return strings.EqualFold(user.Email, identifier) || user.Phone == identifier
+}
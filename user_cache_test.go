@@ -0,0 +1,125 @@
+package passage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserCacheServesRepeatedGets(t *testing.T) {
+	api := newFakeAPI(t, PassageUser{ID: "user-1", Email: "user@example.com"})
+	u := newTestUser(t, api, WithUserCache(NewLRUCache(0), nil))
+
+	for i := 0; i < 3; i++ {
+		user, err := u.Get("user-1")
+		require.NoError(t, err)
+		assert.Equal(t, "user@example.com", user.Email)
+	}
+
+	assert.Equal(t, 1, api.count("get"))
+}
+
+func TestUserCacheInvalidatesOnMutations(t *testing.T) {
+	api := newFakeAPI(t, PassageUser{
+		ID:              "user-1",
+		Email:           "user@example.com",
+		Status:          StatusActive,
+		WebauthnDevices: []WebAuthnDevices{{ID: "device-1"}},
+	})
+	u := newTestUser(t, api, WithUserCache(NewLRUCache(0), nil))
+
+	mutations := map[string]func() error{
+		"deactivate": func() error { _, err := u.Deactivate("user-1"); return err },
+		"activate":   func() error { _, err := u.Activate("user-1"); return err },
+		"update": func() error {
+			_, err := u.Update("user-1", UpdateUserOptions{UserMetadata: map[string]interface{}{"plan": "pro"}})
+			return err
+		},
+		"revoke device": func() error { return u.RevokeDevice("user-1", "device-1") },
+	}
+
+	for name, mutate := range mutations {
+		t.Run(name, func(t *testing.T) {
+			_, err := u.Get("user-1")
+			require.NoError(t, err)
+			gets := api.count("get")
+
+			require.NoError(t, mutate())
+
+			user, err := u.Get("user-1")
+			require.NoError(t, err)
+			assert.Equal(t, gets+1, api.count("get"))
+
+			expected, _ := api.user("user-1")
+			assert.Equal(t, expected.Status, user.Status)
+			assert.Len(t, user.WebauthnDevices, len(expected.WebauthnDevices))
+		})
+	}
+
+	require.NoError(t, u.Delete("user-1"))
+	_, err := u.Get("user-1")
+	assert.True(t, isNotFoundError(err))
+}
+
+func TestUserCacheNegativeCaching(t *testing.T) {
+	api := newFakeAPI(t)
+	u := newTestUser(t, api, WithUserCache(NewLRUCache(0), &UserCacheOptions{NotFoundTTL: time.Minute}))
+
+	for i := 0; i < 2; i++ {
+		_, err := u.GetByIdentifier("new@example.com")
+		assert.True(t, isNotFoundError(err))
+	}
+	assert.Equal(t, 1, api.count("list"))
+
+	_, err := u.Create(CreateUserArgs{Email: "new@example.com"})
+	require.NoError(t, err)
+
+	user, err := u.GetByIdentifier("new@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", user.Email)
+}
+
+func TestUserCacheGetByIdentifier(t *testing.T) {
+	api := newFakeAPI(t, PassageUser{ID: "user-1", Email: "user@example.com"})
+	u := newTestUser(t, api, WithUserCache(NewRedisCache(newFakeRedis(), ""), nil))
+
+	for i := 0; i < 3; i++ {
+		user, err := u.GetByIdentifier("User@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", user.ID)
+	}
+	assert.Equal(t, 1, api.count("list"))
+	assert.Equal(t, 1, api.count("get"))
+
+	// the identifier mapping is dropped once the user no longer has that email
+	_, err := u.Update("user-1", UpdateUserOptions{Email: "changed@example.com"})
+	require.NoError(t, err)
+
+	_, err = u.GetByIdentifier("user@example.com")
+	assert.True(t, isNotFoundError(err))
+
+	user, err := u.GetByIdentifier("changed@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", user.ID)
+}
+
+func TestUserCacheIsNotUsedForPatchMetadata(t *testing.T) {
+	api := newFakeAPI(t, PassageUser{ID: "user-1", UserMetadata: map[string]interface{}{"a": 1}})
+	u := newTestUser(t, api, WithUserCache(NewLRUCache(0), nil))
+
+	_, err := u.Get("user-1")
+	require.NoError(t, err)
+
+	api.add(PassageUser{ID: "user-1", UserMetadata: map[string]interface{}{"a": 1, "b": 2}})
+
+	user, err := u.PatchMetadata(context.Background(), "user-1", MergePatch{"c": 3})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"a": float64(1), "b": float64(2), "c": float64(3)}, user.UserMetadata)
+
+	cached, err := u.Get("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, user.UserMetadata, cached.UserMetadata)
+}
@@ -0,0 +1,104 @@
+package passage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// RevokeAllDevicesOptions configures RevokeAllDevices.
+type RevokeAllDevicesOptions struct {
+	// Concurrency is the maximum number of devices revoked at once. Defaults to 10.
+	Concurrency int
+	// RevokeRefreshTokens also revokes the user's refresh tokens, ending their sessions.
+	RevokeRefreshTokens bool
+	// Deactivate also deactivates the user.
+	Deactivate bool
+}
+
+// RevokeAllDevicesResult is the outcome of RevokeAllDevices.
+type RevokeAllDevicesResult struct {
+	UserID string
+	// DryRun is set if the operation was a dry run, under WithDryRun or CallDryRun. Revoked, RefreshTokensRevoked
+	// and Deactivated then describe what would have been done.
+	DryRun bool
+	// Revoked lists the IDs of the devices that were revoked.
+	Revoked []string
+	// Failed holds the error for every device that could not be revoked.
+	Failed map[string]error
+	// RefreshTokensRevoked is set if the user's refresh tokens were revoked.
+	RefreshTokensRevoked bool
+	// RefreshTokensErr is the error from revoking the user's refresh tokens, if it was requested and failed. It
+	// wraps ErrRevocationNotRecorded, with RefreshTokensRevoked set, if only recording the revocation failed.
+	RefreshTokensErr error
+	// Deactivated is set if the user was deactivated.
+	Deactivated bool
+	// DeactivateErr is the error from deactivating the user, if it was requested and failed. It wraps
+	// ErrRevocationNotRecorded, with Deactivated set, if only recording the revocation failed.
+	DeactivateErr error
+}
+
+// RevokeAllDevices revokes every webauthn device of a user, for example during account recovery. Every step is
+// attempted even if an earlier one fails; the result is returned along with an error describing the failures.
+// Only a failure to list the user's devices returns no result.
+func (u *User) RevokeAllDevices(
+	ctx context.Context,
+	userID string,
+	opts *RevokeAllDevicesOptions,
+) (*RevokeAllDevicesResult, error) {
+	if userID == "" {
+		return nil, errors.New("userID is required.")
+	}
+
+	var options RevokeAllDevicesOptions
+	if opts != nil {
+		options = *opts
+	}
+
+	devices, err := u.listDevices(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceIDs := make([]string, 0, len(devices))
+	for _, device := range devices {
+		deviceIDs = append(deviceIDs, device.ID)
+	}
+
+	report := runBulk(ctx, deviceIDs, &BulkOptions{Concurrency: options.Concurrency}, func(ctx context.Context, deviceID string) error {
+		return u.revokeDevice(ctx, userID, deviceID)
+	})
+
+	result := &RevokeAllDevicesResult{
+		UserID:  userID,
+		DryRun:  u.isDryRun(ctx),
+		Revoked: report.Succeeded,
+		Failed:  report.Failed,
+	}
+
+	var errs []error
+	for deviceID, err := range result.Failed {
+		errs = append(errs, fmt.Errorf("failed to revoke device %q: %w", deviceID, err))
+	}
+
+	if options.RevokeRefreshTokens {
+		err := u.revokeRefreshTokens(ctx, userID)
+		// the tokens were revoked even if the revocation couldn't be recorded locally
+		result.RefreshTokensRevoked = err == nil || errors.Is(err, ErrRevocationNotRecorded)
+		if err != nil {
+			result.RefreshTokensErr = err
+			errs = append(errs, fmt.Errorf("failed to revoke refresh tokens: %w", err))
+		}
+	}
+
+	if options.Deactivate {
+		_, err := u.deactivate(ctx, userID)
+		result.Deactivated = err == nil || errors.Is(err, ErrRevocationNotRecorded)
+		if err != nil {
+			result.DeactivateErr = err
+			errs = append(errs, fmt.Errorf("failed to deactivate user: %w", err))
+		}
+	}
+
+	return result, errors.Join(errs...)
+}
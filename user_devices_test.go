@@ -0,0 +1,86 @@
+package passage
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRevokeAllDevicesTestAPI(t *testing.T) *fakeAPI {
+	return newFakeAPI(t, PassageUser{ID: "user-1", Status: StatusActive, WebauthnDevices: []WebAuthnDevices{
+		{ID: "device-1"}, {ID: "device-2"}, {ID: "device-3"},
+	}})
+}
+
+func TestRevokeAllDevices(t *testing.T) {
+	api := newRevokeAllDevicesTestAPI(t)
+	u := newTestUser(t, api)
+
+	result, err := u.RevokeAllDevices(context.Background(), "user-1", &RevokeAllDevicesOptions{
+		Concurrency:         2,
+		RevokeRefreshTokens: true,
+		Deactivate:          true,
+	})
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"device-1", "device-2", "device-3"}, result.Revoked)
+	assert.Empty(t, result.Failed)
+	assert.True(t, result.RefreshTokensRevoked)
+	assert.True(t, result.Deactivated)
+
+	user, _ := api.user("user-1")
+	assert.Empty(t, user.WebauthnDevices)
+	assert.Equal(t, StatusInactive, user.Status)
+	assert.Equal(t, 1, api.count("revoke_tokens"))
+}
+
+func TestRevokeAllDevicesContinuesAfterFailures(t *testing.T) {
+	api := newRevokeAllDevicesTestAPI(t)
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/devices/device-2") {
+			writeJSON(t, w, http.StatusInternalServerError, N500Error{Code: InternalServerError, Error: "boom"})
+			return
+		}
+		api.ServeHTTP(w, r)
+	}))
+
+	result, err := u.RevokeAllDevices(context.Background(), "user-1", &RevokeAllDevicesOptions{Deactivate: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "device-2")
+
+	assert.ElementsMatch(t, []string{"device-1", "device-3"}, result.Revoked)
+	require.Contains(t, result.Failed, "device-2")
+	assert.True(t, result.Deactivated)
+	assert.False(t, result.RefreshTokensRevoked)
+	assert.Equal(t, 0, api.count("revoke_tokens"))
+}
+
+func TestRevokeAllDevicesWhenRevocationIsNotRecorded(t *testing.T) {
+	api := newRevokeAllDevicesTestAPI(t)
+	u := newTestUser(t, api, WithRevocationStore(failingRevocationStore{}))
+
+	result, err := u.RevokeAllDevices(context.Background(), "user-1", &RevokeAllDevicesOptions{
+		RevokeRefreshTokens: true,
+		Deactivate:          true,
+	})
+	assert.ErrorIs(t, err, ErrRevocationNotRecorded)
+
+	assert.True(t, result.RefreshTokensRevoked)
+	assert.ErrorIs(t, result.RefreshTokensErr, ErrRevocationNotRecorded)
+	assert.True(t, result.Deactivated)
+	assert.ErrorIs(t, result.DeactivateErr, ErrRevocationNotRecorded)
+	assert.Equal(t, 1, api.count("revoke_tokens"))
+	assert.Equal(t, 1, api.count("deactivate"))
+}
+
+func TestRevokeAllDevicesUserNotFound(t *testing.T) {
+	u := newTestUser(t, newFakeAPI(t))
+
+	result, err := u.RevokeAllDevices(context.Background(), "missing", nil)
+	assert.Nil(t, result)
+	assert.True(t, isNotFoundError(err))
+}
@@ -0,0 +1,206 @@
+package passage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// ErrDryRunNotSupported is returned by Auth operations that create magic links when they are called as a dry run,
+// with WithDryRun or CallDryRun, since they can't tell what would be created without creating it.
+var ErrDryRunNotSupported = errors.New("magic links can't be created in a dry run")
+
+// UserChange describes a change a mutating User operation would make. It is reported by dry runs.
+type UserChange struct {
+	Operation Operation
+	// UserID is empty when a user would be created.
+	UserID string
+	// DeviceID is the device that would be revoked by RevokeDevice.
+	DeviceID string
+	// Before is the user's current state. It is nil when a user would be created.
+	Before *PassageUser
+	// After is the user as they would be after the change. It is nil when they would be deleted.
+	After *PassageUser
+	// Diff lists the fields that would change. It is empty when the operation would change nothing, such as
+	// activating a user who is already active, and for RevokeRefreshTokens, whose effect isn't part of the user.
+	Diff []FieldChange
+}
+
+// FieldChange is a change to one field of a user.
+type FieldChange struct {
+	// Field is the field's JSON name. Changes to user metadata are listed per key, as "user_metadata.<key>", and
+	// changes to webauthn devices as "webauthn_devices", holding their IDs.
+	Field  string
+	Before any
+	After  any
+}
+
+// WithDryRun makes Create, Update, Activate, Deactivate, Delete, RevokeDevice and RevokeRefreshTokens, and the
+// operations built on them such as PatchMetadata and the bulk operations, dry runs: they validate their input and
+// fetch the user's current state, but don't make the change. Each change that would have been made is passed to
+// report, which may be nil.
+//
+// In a dry run, Create, Update, Activate and Deactivate return the user as they would be after the change. Create
+// fails like the API would if a user already has the email or phone number. Auth operations that create magic links
+// fail with ErrDryRunNotSupported, except CreateMagicLinksBulk with BulkOptions.DryRun set.
+func WithDryRun(report func(UserChange)) Option {
+	return func(cfg *config) error {
+		if report == nil {
+			report = func(UserChange) {}
+		}
+
+		cfg.dryRun = report
+		return nil
+	}
+}
+
+type dryRunCapture struct {
+	mu  sync.Mutex
+	dst *UserChange
+}
+
+// CallDryRun makes the call a dry run like WithDryRun does, storing the change it would make in dst. For calls that
+// would make several changes, it is the last one. Calls creating magic links fail with ErrDryRunNotSupported.
+func CallDryRun(dst *UserChange) CallOption {
+	return func(opts *callOptions) {
+		opts.dryRun = &dryRunCapture{dst: dst}
+	}
+}
+
+func (u *User) isDryRun(ctx context.Context) bool {
+	return u.dryRun != nil || callOptionsFrom(ctx).dryRun != nil
+}
+
+// checkDryRun returns ErrDryRunNotSupported if ctx is part of a dry run, for operations that can't be dry runs.
+func (a *Auth) checkDryRun(ctx context.Context) error {
+	if a.dryRun || callOptionsFrom(ctx).dryRun != nil {
+		return ErrDryRunNotSupported
+	}
+
+	return nil
+}
+
+// reportDryRun completes change with its diff and reports it to the dry runs ctx is part of.
+func (u *User) reportDryRun(ctx context.Context, change UserChange) {
+	change.Diff = diffUsers(change.Before, change.After)
+
+	if u.dryRun != nil {
+		u.dryRun(change)
+	}
+
+	if capture := callOptionsFrom(ctx).dryRun; capture != nil {
+		capture.mu.Lock()
+		*capture.dst = change
+		capture.mu.Unlock()
+	}
+}
+
+// dryRunChange fetches the user's current state and reports the change edit would make to it. It returns the user
+// as they would be after the change.
+func (u *User) dryRunChange(ctx context.Context, operation Operation, userID string, edit func(user *PassageUser)) (*PassageUser, error) {
+	before, err := u.getUncached(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	after := cloneUser(before)
+	edit(after)
+
+	u.reportDryRun(ctx, UserChange{Operation: operation, UserID: userID, Before: before, After: after})
+	return cloneUser(after), nil
+}
+
+func (u *User) dryRunCreate(ctx context.Context, args CreateUserArgs) (*PassageUser, error) {
+	existing, err := u.findExisting(ctx, args)
+	if err == nil {
+		return nil, PassageError{
+			Message:    fmt.Sprintf("User %s already has that email or phone.", existing.ID),
+			ErrorCode:  "user_already_exists",
+			StatusCode: http.StatusConflict,
+		}
+	}
+
+	if !isNotFoundError(err) {
+		return nil, err
+	}
+
+	after := &PassageUser{
+		Email:        args.Email,
+		Phone:        args.Phone,
+		UserMetadata: maps.Clone(args.UserMetadata),
+	}
+
+	u.reportDryRun(ctx, UserChange{Operation: OperationCreateUser, After: after})
+	return cloneUser(after), nil
+}
+
+func (u *User) dryRunDelete(ctx context.Context, userID string) error {
+	before, err := u.getUncached(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	u.reportDryRun(ctx, UserChange{Operation: OperationDeleteUser, UserID: userID, Before: before})
+	return nil
+}
+
+func (u *User) dryRunRevokeDevice(ctx context.Context, userID string, deviceID string) error {
+	_, err := u.dryRunChange(ctx, OperationDeleteUserDevices, userID, func(user *PassageUser) {
+		user.WebauthnDevices = slices.DeleteFunc(user.WebauthnDevices, func(device WebAuthnDevices) bool {
+			return device.ID == deviceID
+		})
+	})
+
+	return err
+}
+
+// diffUsers lists the changes from before to after. A nil user has no fields set.
+func diffUsers(before, after *PassageUser) []FieldChange {
+	if before == nil {
+		before = &PassageUser{}
+	}
+	if after == nil {
+		after = &PassageUser{}
+	}
+
+	var diff []FieldChange
+	add := func(field string, from, to any) {
+		if !reflect.DeepEqual(from, to) {
+			diff = append(diff, FieldChange{Field: field, Before: from, After: to})
+		}
+	}
+
+	add("email", before.Email, after.Email)
+	add("phone", before.Phone, after.Phone)
+	add("status", before.Status, after.Status)
+
+	keys := slices.Sorted(maps.Keys(before.UserMetadata))
+	for key := range after.UserMetadata {
+		if _, ok := before.UserMetadata[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		add("user_metadata."+key, before.UserMetadata[key], after.UserMetadata[key])
+	}
+
+	add("webauthn_devices", deviceIDs(before.WebauthnDevices), deviceIDs(after.WebauthnDevices))
+
+	return diff
+}
+
+func deviceIDs(devices []WebAuthnDevices) []string {
+	ids := make([]string, 0, len(devices))
+	for _, device := range devices {
+		ids = append(ids, device.ID)
+	}
+
+	return ids
+}
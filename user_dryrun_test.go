@@ -0,0 +1,220 @@
+package passage
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDryRunTestAPI(t *testing.T) *fakeAPI {
+	return newFakeAPI(t, PassageUser{
+		ID:              "user-1",
+		Email:           "a@example.com",
+		Status:          StatusActive,
+		UserMetadata:    map[string]interface{}{"plan": "free", "team": "red"},
+		WebauthnDevices: []WebAuthnDevices{{ID: "device-1"}, {ID: "device-2"}},
+	})
+}
+
+// mutations is the number of mutating requests api has received.
+func mutations(api *fakeAPI) int {
+	total := 0
+	for _, operation := range []string{"create", "update", "delete", "activate", "deactivate", "revoke_tokens", "revoke_device"} {
+		total += api.count(operation)
+	}
+
+	return total
+}
+
+func TestCallDryRunUpdate(t *testing.T) {
+	api := newDryRunTestAPI(t)
+	u := newTestUser(t, api)
+
+	var change UserChange
+	user, err := u.Update("user-1", UpdateUserOptions{
+		Email:        "b@example.com",
+		UserMetadata: map[string]interface{}{"plan": "pro", "team": "red", "seats": float64(5)},
+	}, CallDryRun(&change))
+	require.NoError(t, err)
+	assert.Equal(t, "b@example.com", user.Email)
+
+	assert.Equal(t, OperationUpdateUser, change.Operation)
+	assert.Equal(t, "user-1", change.UserID)
+	assert.Equal(t, "a@example.com", change.Before.Email)
+	assert.Equal(t, []FieldChange{
+		{Field: "email", Before: "a@example.com", After: "b@example.com"},
+		{Field: "user_metadata.plan", Before: "free", After: "pro"},
+		{Field: "user_metadata.seats", Before: nil, After: float64(5)},
+	}, change.Diff)
+
+	assert.Equal(t, 0, mutations(api))
+	current, err := u.Get("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, "a@example.com", current.Email)
+}
+
+func TestWithDryRunCoversEveryMutation(t *testing.T) {
+	api := newDryRunTestAPI(t)
+	var changes []UserChange
+	u := newTestUser(t, api, WithDryRun(func(change UserChange) { changes = append(changes, change) }))
+
+	created, err := u.Create(CreateUserArgs{Email: "new@example.com"})
+	require.NoError(t, err)
+	assert.Empty(t, created.ID)
+
+	_, err = u.Update("user-1", UpdateUserOptions{Phone: "+15005550006"})
+	require.NoError(t, err)
+
+	activated, err := u.Activate("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusActive, activated.Status)
+
+	deactivated, err := u.Deactivate("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusInactive, deactivated.Status)
+
+	require.NoError(t, u.RevokeDevice("user-1", "device-1"))
+	require.NoError(t, u.RevokeRefreshTokens("user-1"))
+	require.NoError(t, u.Delete("user-1"))
+
+	assert.Equal(t, 0, mutations(api))
+	require.Len(t, changes, 7)
+
+	assert.Equal(t, OperationCreateUser, changes[0].Operation)
+	assert.Nil(t, changes[0].Before)
+	assert.Equal(t, []FieldChange{{Field: "email", Before: "", After: "new@example.com"}}, changes[0].Diff)
+
+	assert.Equal(t, []FieldChange{{Field: "phone", Before: "", After: "+15005550006"}}, changes[1].Diff)
+
+	// activating an active user changes nothing
+	assert.Equal(t, OperationActivateUser, changes[2].Operation)
+	assert.Empty(t, changes[2].Diff)
+
+	assert.Equal(t, []FieldChange{{Field: "status", Before: StatusActive, After: StatusInactive}}, changes[3].Diff)
+
+	assert.Equal(t, OperationDeleteUserDevices, changes[4].Operation)
+	assert.Equal(t, []FieldChange{
+		{Field: "webauthn_devices", Before: []string{"device-1", "device-2"}, After: []string{"device-2"}},
+	}, changes[4].Diff)
+
+	assert.Equal(t, OperationRevokeUserRefreshTokens, changes[5].Operation)
+	assert.Empty(t, changes[5].Diff)
+
+	assert.Equal(t, OperationDeleteUser, changes[6].Operation)
+	assert.Nil(t, changes[6].After)
+	assert.Contains(t, changes[6].Diff, FieldChange{Field: "email", Before: "a@example.com", After: ""})
+}
+
+func TestDryRunCreateReportsConflicts(t *testing.T) {
+	api := newDryRunTestAPI(t)
+	u := newTestUser(t, api, WithDryRun(nil))
+
+	_, err := u.Create(CreateUserArgs{Email: "A@example.com"})
+
+	var passageErr PassageError
+	require.ErrorAs(t, err, &passageErr)
+	assert.Equal(t, http.StatusConflict, passageErr.StatusCode)
+	assert.True(t, isUserExistsError(err))
+	assert.Equal(t, 0, mutations(api))
+}
+
+func TestDryRunValidatesAndFetches(t *testing.T) {
+	api := newDryRunTestAPI(t)
+	u := newTestUser(t, api, WithDryRun(nil))
+
+	_, err := u.Update("user-1", UpdateUserOptions{Email: "not an email"})
+	assert.Error(t, err)
+	assert.Equal(t, 0, api.count("get"))
+
+	err = u.Delete("missing")
+	assert.True(t, isNotFoundError(err))
+}
+
+func TestDryRunPatchMetadata(t *testing.T) {
+	api := newDryRunTestAPI(t)
+	u := newTestUser(t, api)
+
+	var change UserChange
+	ctx := WithCallOptions(context.Background(), CallDryRun(&change))
+	user, err := u.PatchMetadata(ctx, "user-1", MergePatch(map[string]interface{}{"team": nil}))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{"plan": "free"}, user.UserMetadata)
+	assert.Equal(t, []FieldChange{{Field: "user_metadata.team", Before: "red", After: nil}}, change.Diff)
+	assert.Equal(t, 0, mutations(api))
+}
+
+func TestDryRunRejectsMagicLinks(t *testing.T) {
+	var change UserChange
+	auth, requests, _ := newMagicLinkTestAuth(t)
+
+	_, err := auth.CreateMagicLinkWithEmail("a@example.com", LoginType, true, nil, CallDryRun(&change))
+	assert.ErrorIs(t, err, ErrDryRunNotSupported)
+
+	ctx := WithCallOptions(context.Background(), CallDryRun(&change))
+	_, err = auth.SendMagicLink(ctx, MagicLinkRecipient{Email: "a@example.com"}, LoginType, nil)
+	assert.ErrorIs(t, err, ErrDryRunNotSupported)
+
+	recipients := []BulkMagicLinkRecipient{{MagicLinkRecipient: MagicLinkRecipient{Email: "a@example.com"}}}
+	_, err = auth.CreateMagicLinksBulk(ctx, recipients, &BulkMagicLinkOptions{Type: LoginType})
+	assert.ErrorIs(t, err, ErrDryRunNotSupported)
+
+	auth, requests, _ = newMagicLinkTestAuth(t, WithDryRun(nil))
+	_, err = auth.CreateMagicLinkWithEmail("a@example.com", LoginType, true, nil)
+	assert.ErrorIs(t, err, ErrDryRunNotSupported)
+
+	// a bulk dry run only validates, so it is allowed
+	report, err := auth.CreateMagicLinksBulk(context.Background(), recipients, &BulkMagicLinkOptions{
+		BulkOptions: BulkOptions{DryRun: true},
+		Type:        LoginType,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, report.Failed())
+
+	assert.Equal(t, int32(0), requests.Load())
+}
+
+func TestDryRunCompositeOperations(t *testing.T) {
+	var changes []UserChange
+	var mu sync.Mutex
+	report := func(change UserChange) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, change)
+	}
+
+	api := newRevokeAllDevicesTestAPI(t)
+	u := newTestUser(t, api, WithDryRun(report))
+	ctx := context.Background()
+
+	result, err := u.RevokeAllDevices(ctx, "user-1", &RevokeAllDevicesOptions{RevokeRefreshTokens: true, Deactivate: true})
+	require.NoError(t, err)
+	assert.True(t, result.DryRun)
+	assert.Len(t, result.Revoked, 3)
+
+	policy := DevicePolicy{MaxDevices: 1}
+	policyReport, err := u.ApplyDevicePolicy(ctx, "user-1", policy, &DevicePolicyOptions{Revoke: true})
+	require.NoError(t, err)
+	assert.True(t, policyReport.DryRun)
+	require.NotEmpty(t, policyReport.Violations)
+	for _, violation := range policyReport.Violations {
+		assert.Equal(t, DeviceWouldRevoke, violation.Action)
+	}
+
+	bulkReport, err := u.RevokeRefreshTokensWhere(ctx, UserQuery{}, nil)
+	require.NoError(t, err)
+	assert.True(t, bulkReport.DryRun)
+	assert.Equal(t, []string{"user-1"}, bulkReport.Matched)
+	assert.Empty(t, bulkReport.Succeeded)
+
+	// nothing was changed, but every change was reported
+	user, _ := api.user("user-1")
+	assert.Len(t, user.WebauthnDevices, 3)
+	assert.Equal(t, StatusActive, user.Status)
+	assert.Equal(t, 0, api.count("revoke_device")+api.count("revoke_tokens")+api.count("deactivate"))
+	assert.NotEmpty(t, changes)
+}
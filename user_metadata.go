@@ -0,0 +1,218 @@
+package passage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// MetadataError is returned when user metadata cannot be mapped to or from a Go type.
+type MetadataError struct {
+	// Field is the dotted JSON path of the offending field. It is empty when the whole document is at fault.
+	Field string
+	// Type is the Go type that was being decoded into or encoded from.
+	Type string
+	Err  error
+}
+
+func (e MetadataError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("MetadataError - ")
+
+	if e.Type != "" {
+		sb.WriteString(fmt.Sprintf("type: %s, ", e.Type))
+	}
+
+	if e.Field != "" {
+		sb.WriteString(fmt.Sprintf("field: %s, ", e.Field))
+	}
+
+	if e.Err != nil {
+		sb.WriteString(fmt.Sprintf("error: %v, ", e.Err))
+	}
+
+	return strings.TrimSuffix(sb.String(), ", ")
+}
+
+func (e MetadataError) Unwrap() error {
+	return e.Err
+}
+
+// GetTyped retrieves a user's object using their user ID and decodes their user metadata into T.
+// Fields are mapped using T's JSON struct tags.
+func GetTyped[T any](ctx context.Context, u *User, userID string) (*PassageUser, T, error) {
+	var metadata T
+
+	user, err := u.get(ctx, userID)
+	if err != nil {
+		return nil, metadata, err
+	}
+
+	metadata, err = DecodeMetadata[T](user.UserMetadata)
+	if err != nil {
+		return nil, metadata, err
+	}
+
+	return user, metadata, nil
+}
+
+// UpdateMetadata encodes metadata using its JSON struct tags and sets it as the user's metadata.
+func UpdateMetadata[T any](ctx context.Context, u *User, userID string, metadata T) (*PassageUser, error) {
+	encoded, err := EncodeMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.updateMetadata(ctx, userID, encoded)
+}
+
+// PatchMetadata applies a MergePatch or JSONPatch to a user's metadata. The user is read, the patch is applied to
+// their metadata and the result is written back. The Passage API replaces metadata as a whole and has no way to
+// make the write conditional, so PatchMetadata is last-writer-wins: a concurrent write that lands between the read
+// and the update is overwritten.
+func (u *User) PatchMetadata(ctx context.Context, userID string, patch MetadataPatch) (*PassageUser, error) {
+	if userID == "" {
+		return nil, errors.New("userID is required.")
+	}
+
+	if patch == nil {
+		return nil, errors.New("patch is required.")
+	}
+
+	user, err := u.getUncached(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := json.Marshal(user.UserMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	// apply may modify metadata, so it works on a copy decoded from original
+	var metadata map[string]interface{}
+	if err := json.Unmarshal(original, &metadata); err != nil {
+		return nil, err
+	}
+
+	patched, err := patch.apply(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(patched)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(original, encoded) || (len(user.UserMetadata) == 0 && len(patched) == 0) {
+		return user, nil
+	}
+
+	return u.updateMetadata(ctx, userID, patched)
+}
+
+// updateMetadata replaces a user's metadata. Unlike Update, it always sends the user_metadata field, so metadata
+// can be cleared by passing an empty map.
+func (u *User) updateMetadata(ctx context.Context, userID string, metadata map[string]interface{}) (*PassageUser, error) {
+	if userID == "" {
+		return nil, errors.New("userID is required.")
+	}
+
+	if err := validateMetadata(metadata, u.metadataRules); err != nil {
+		return nil, err
+	}
+
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+
+	if u.isDryRun(ctx) {
+		return u.dryRunChange(ctx, OperationUpdateUser, userID, func(user *PassageUser) {
+			user.UserMetadata = maps.Clone(metadata)
+		})
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"user_metadata": metadata})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := u.client.UpdateUserWithBodyWithResponse(
+		ctx, u.appID, userID, "application/json", bytes.NewReader(body), requestEditors(ctx)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.JSON200 != nil {
+		u.invalidate(ctx, userID, &res.JSON200.PassageUser)
+		return &res.JSON200.PassageUser, nil
+	}
+
+	return nil, errorFromResponse(res.HTTPResponse, res.Body)
+}
+
+// DecodeMetadata decodes user metadata, such as PassageUser.UserMetadata, into T.
+func DecodeMetadata[T any](metadata map[string]interface{}) (T, error) {
+	var decoded T
+	typeName := fmt.Sprintf("%T", decoded)
+
+	if metadata == nil {
+		return decoded, nil
+	}
+
+	raw, err := json.Marshal(metadata)
+	if err != nil {
+		return decoded, MetadataError{Type: typeName, Err: err}
+	}
+
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return decoded, metadataErrorFrom(typeName, err)
+	}
+
+	return decoded, nil
+}
+
+// EncodeMetadata encodes metadata into the map form used by CreateUserArgs and UpdateUserOptions.
+// metadata must encode to a JSON object, so it is typically a struct or a map with string keys.
+func EncodeMetadata[T any](metadata T) (map[string]interface{}, error) {
+	typeName := fmt.Sprintf("%T", metadata)
+
+	raw, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, metadataErrorFrom(typeName, err)
+	}
+
+	var encoded map[string]interface{}
+	if err := json.Unmarshal(raw, &encoded); err != nil {
+		return nil, MetadataError{Type: typeName, Err: errors.New("metadata must encode to a JSON object")}
+	}
+
+	return encoded, nil
+}
+
+func metadataErrorFrom(typeName string, err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return MetadataError{
+			Field: typeErr.Field,
+			Type:  typeName,
+			Err:   fmt.Errorf("cannot use JSON %s as Go %s", typeErr.Value, typeErr.Type),
+		}
+	}
+
+	var unsupportedErr *json.UnsupportedTypeError
+	if errors.As(err, &unsupportedErr) {
+		return MetadataError{
+			Type: typeName,
+			Err:  fmt.Errorf("unsupported Go type %s", unsupportedErr.Type),
+		}
+	}
+
+	return MetadataError{Type: typeName, Err: err}
+}
@@ -0,0 +1,72 @@
+package passage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testProfile struct {
+	Plan     string   `json:"plan"`
+	Seats    int      `json:"seats"`
+	Features []string `json:"features,omitempty"`
+}
+
+func TestGetTyped(t *testing.T) {
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/apps/test-app/users/user-1", r.URL.Path)
+		writeJSON(t, w, http.StatusOK, UserResponse{PassageUser: PassageUser{
+			ID:           "user-1",
+			UserMetadata: map[string]interface{}{"plan": "pro", "seats": 5, "unmapped": true},
+		}})
+	}))
+
+	user, profile, err := GetTyped[testProfile](context.Background(), u, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", user.ID)
+	assert.Equal(t, testProfile{Plan: "pro", Seats: 5}, profile)
+}
+
+func TestGetTypedShapeMismatch(t *testing.T) {
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, http.StatusOK, UserResponse{PassageUser: PassageUser{
+			ID:           "user-1",
+			UserMetadata: map[string]interface{}{"plan": "pro", "seats": "five"},
+		}})
+	}))
+
+	_, _, err := GetTyped[testProfile](context.Background(), u, "user-1")
+
+	var metadataErr MetadataError
+	require.ErrorAs(t, err, &metadataErr)
+	assert.Equal(t, "seats", metadataErr.Field)
+	assert.Equal(t, "passage.testProfile", metadataErr.Type)
+}
+
+func TestUpdateMetadata(t *testing.T) {
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPatch, r.Method)
+
+		var body UpdateUserOptions
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]interface{}{"plan": "team", "seats": float64(10), "features": []interface{}{"sso"}}, body.UserMetadata)
+
+		writeJSON(t, w, http.StatusOK, UserResponse{PassageUser: PassageUser{ID: "user-1", UserMetadata: body.UserMetadata}})
+	}))
+
+	user, err := UpdateMetadata(context.Background(), u, "user-1", testProfile{Plan: "team", Seats: 10, Features: []string{"sso"}})
+	require.NoError(t, err)
+	assert.Equal(t, "team", user.UserMetadata["plan"])
+}
+
+func TestEncodeMetadataRequiresObject(t *testing.T) {
+	_, err := EncodeMetadata([]string{"not", "an", "object"})
+
+	var metadataErr MetadataError
+	require.ErrorAs(t, err, &metadataErr)
+	assert.Equal(t, "[]string", metadataErr.Type)
+}
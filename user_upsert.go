@@ -0,0 +1,109 @@
+package passage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Upsert creates a user, or finds the existing user when one already has args.Email or args.Phone.
+// When the user already exists, args.UserMetadata is merged into their metadata using PatchMetadata.
+// The returned bool reports whether the user was created.
+func (u *User) Upsert(ctx context.Context, args CreateUserArgs) (*PassageUser, bool, error) {
+	user, err := u.create(ctx, args)
+	if err == nil {
+		return user, true, nil
+	}
+
+	if !isUserExistsError(err) {
+		return nil, false, err
+	}
+
+	user, err = u.findExisting(ctx, args)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(args.UserMetadata) == 0 {
+		return user, false, nil
+	}
+
+	user, err = u.PatchMetadata(ctx, user.ID, MergePatch(args.UserMetadata))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return user, false, nil
+}
+
+// FindOrCreate retrieves the user with the given identifier, creating them with args if they don't exist.
+// If neither args.Email nor args.Phone is set, the identifier is used as the email or phone number.
+// Concurrent callers racing to create the same user all receive the one user that was created.
+// The returned bool reports whether the user was created by this call.
+func (u *User) FindOrCreate(ctx context.Context, identifier string, args CreateUserArgs) (*PassageUser, bool, error) {
+	if identifier == "" {
+		return nil, false, errors.New("identifier is required.")
+	}
+
+	user, err := u.getByIdentifier(ctx, identifier)
+	if err == nil {
+		return user, false, nil
+	}
+
+	if !isNotFoundError(err) {
+		return nil, false, err
+	}
+
+	if args.Email == "" && args.Phone == "" {
+		if strings.Contains(identifier, "@") {
+			args.Email = identifier
+		} else {
+			args.Phone = identifier
+		}
+	}
+
+	user, err = u.create(ctx, args)
+	if err == nil {
+		return user, true, nil
+	}
+
+	if !isUserExistsError(err) {
+		return nil, false, err
+	}
+
+	// the first lookup may have cached that the user doesn't exist
+	u.forgetIdentifiers(ctx, identifier)
+
+	user, err = u.getByIdentifier(ctx, identifier)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return user, false, nil
+}
+
+// findExisting looks up the user that caused a create conflict by email, then by phone number.
+func (u *User) findExisting(ctx context.Context, args CreateUserArgs) (*PassageUser, error) {
+	args, err := validateCreateUserArgs(args, u.metadataRules)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, identifier := range []string{args.Email, args.Phone} {
+		if identifier == "" {
+			continue
+		}
+
+		user, err := u.getByIdentifier(ctx, identifier)
+		if err == nil || !isNotFoundError(err) {
+			return user, err
+		}
+	}
+
+	return nil, PassageError{
+		Message:    "Could not find the existing user with that email or phone.",
+		ErrorCode:  "user_not_found",
+		StatusCode: http.StatusNotFound,
+	}
+}
@@ -0,0 +1,105 @@
+package passage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpsertCreatesNewUser(t *testing.T) {
+	api := newFakeAPI(t)
+	u := newTestUser(t, api)
+
+	user, created, err := u.Upsert(context.Background(), CreateUserArgs{Email: "new@example.com"})
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "new@example.com", user.Email)
+}
+
+func TestUpsertMergesMetadataIntoExistingUser(t *testing.T) {
+	api := newFakeAPI(t, PassageUser{
+		ID:           "user-1",
+		Email:        "existing@example.com",
+		UserMetadata: map[string]interface{}{"plan": "pro", "seats": 5},
+	})
+	u := newTestUser(t, api)
+
+	user, created, err := u.Upsert(context.Background(), CreateUserArgs{
+		Email:        "Existing@example.com",
+		UserMetadata: map[string]interface{}{"seats": 10},
+	})
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "user-1", user.ID)
+	assert.Equal(t, map[string]interface{}{"plan": "pro", "seats": float64(10)}, user.UserMetadata)
+}
+
+func TestFindOrCreateReturnsExistingUser(t *testing.T) {
+	api := newFakeAPI(t, PassageUser{ID: "user-1", Email: "existing@example.com"})
+	u := newTestUser(t, api)
+
+	user, created, err := u.FindOrCreate(context.Background(), "existing@example.com", CreateUserArgs{})
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "user-1", user.ID)
+	assert.Equal(t, 0, api.count("create"))
+}
+
+func TestFindOrCreateUsesIdentifierForNewUser(t *testing.T) {
+	api := newFakeAPI(t)
+	u := newTestUser(t, api)
+
+	user, created, err := u.FindOrCreate(context.Background(), "+15550102030", CreateUserArgs{})
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "+15550102030", user.Phone)
+}
+
+func TestFindOrCreateFallsBackToLookupWhenRacingCreate(t *testing.T) {
+	api := newFakeAPI(t)
+	// another request creates the user after our lookup but before our create
+	api.beforeCreate = func(args CreateUserArgs) {
+		api.add(PassageUser{ID: "winner", Email: args.Email})
+	}
+	u := newTestUser(t, api)
+
+	user, created, err := u.FindOrCreate(context.Background(), "race@example.com", CreateUserArgs{})
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "winner", user.ID)
+}
+
+func TestFindOrCreateWithNegativeCacheFallsBackToLookupWhenRacingCreate(t *testing.T) {
+	for _, identifier := range []string{"race@example.com", "+15550102030"} {
+		t.Run(identifier, func(t *testing.T) {
+			api := newFakeAPI(t)
+			api.beforeCreate = func(args CreateUserArgs) {
+				api.add(PassageUser{ID: "winner", Email: args.Email, Phone: args.Phone})
+			}
+			u := newTestUser(t, api, WithUserCache(NewLRUCache(0), &UserCacheOptions{NotFoundTTL: time.Minute}))
+
+			user, created, err := u.FindOrCreate(context.Background(), identifier, CreateUserArgs{})
+			require.NoError(t, err)
+			assert.False(t, created)
+			assert.Equal(t, "winner", user.ID)
+		})
+	}
+}
+
+func TestUpsertWithNegativeCacheFindsUserCreatedConcurrently(t *testing.T) {
+	api := newFakeAPI(t)
+	u := newTestUser(t, api, WithUserCache(NewLRUCache(0), &UserCacheOptions{NotFoundTTL: time.Minute}))
+
+	_, err := u.GetByIdentifier("race@example.com")
+	require.True(t, isNotFoundError(err))
+
+	api.add(PassageUser{ID: "winner", Email: "race@example.com"})
+
+	user, created, err := u.Upsert(context.Background(), CreateUserArgs{Email: "race@example.com"})
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "winner", user.ID)
+}
@@ -0,0 +1,189 @@
+package passage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const maxEmailLength = 254
+
+var (
+	e164Pattern     = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+	phoneFormatting = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+)
+
+// FieldError describes a single field that failed validation.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidationError is returned before any request is sent when arguments fail client-side validation.
+// It lists every problem found rather than only the first.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e ValidationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("ValidationError - ")
+
+	for _, fieldErr := range e.Errors {
+		if fieldErr.Field != "" {
+			sb.WriteString(fmt.Sprintf("%s: ", fieldErr.Field))
+		}
+		sb.WriteString(fmt.Sprintf("%s, ", fieldErr.Message))
+	}
+
+	return strings.TrimSuffix(sb.String(), ", ")
+}
+
+// MetadataRules restricts the user metadata User accepts, so metadata that doesn't fit an app's schema is rejected
+// before any request is sent. The Passage API's own limits aren't known to the SDK, so none are applied by default.
+type MetadataRules struct {
+	// AllowedKeys lists the keys user metadata may have. Any key is allowed when it is empty.
+	AllowedKeys []string
+	// MaxBytes limits the size of user metadata encoded as JSON. It is unlimited when 0.
+	MaxBytes int
+}
+
+// WithMetadataRules validates the user metadata passed to Create, Update, PatchMetadata and the operations built
+// on them against rules.
+func WithMetadataRules(rules MetadataRules) Option {
+	return func(cfg *config) error {
+		if rules.MaxBytes < 0 {
+			return errors.New("MaxBytes must not be negative.")
+		}
+
+		rules.AllowedKeys = slices.Clone(rules.AllowedKeys)
+		cfg.metadataRules = &rules
+		return nil
+	}
+}
+
+type validator struct {
+	// metadataRules, when set, are the metadata rules configured with WithMetadataRules.
+	metadataRules *MetadataRules
+	errors        []FieldError
+}
+
+func (v *validator) add(field string, format string, args ...any) {
+	v.errors = append(v.errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+
+	return ValidationError{Errors: v.errors}
+}
+
+// validateCreateUserArgs validates args and returns a copy with the phone number normalized to E.164.
+func validateCreateUserArgs(args CreateUserArgs, rules *MetadataRules) (CreateUserArgs, error) {
+	if args.Email == "" && args.Phone == "" {
+		return args, errors.New("At least one of args.Email or args.Phone is required.")
+	}
+
+	v := validator{metadataRules: rules}
+
+	args.Email = v.email("Email", args.Email)
+	args.Phone = v.phone("Phone", args.Phone)
+	v.metadata("UserMetadata", args.UserMetadata)
+
+	return args, v.err()
+}
+
+// validateUpdateUserOptions validates options and returns a copy with the phone number normalized to E.164.
+func validateUpdateUserOptions(options UpdateUserOptions, rules *MetadataRules) (UpdateUserOptions, error) {
+	v := validator{metadataRules: rules}
+
+	options.Email = v.email("Email", options.Email)
+	options.Phone = v.phone("Phone", options.Phone)
+	v.metadata("UserMetadata", options.UserMetadata)
+
+	return options, v.err()
+}
+
+func validateMetadata(metadata map[string]interface{}, rules *MetadataRules) error {
+	v := validator{metadataRules: rules}
+	v.metadata("UserMetadata", metadata)
+
+	return v.err()
+}
+
+func (v *validator) email(field string, email string) string {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return email
+	}
+
+	if len(email) > maxEmailLength {
+		v.add(field, "must be at most %d characters", maxEmailLength)
+		return email
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		v.add(field, "%q is not a valid email address", email)
+	}
+
+	return email
+}
+
+// phone normalizes common formatting such as spaces, dashes, parentheses and a leading 00 international prefix
+// before checking that the result is an E.164 phone number.
+func (v *validator) phone(field string, phone string) string {
+	if phone == "" {
+		return phone
+	}
+
+	normalized := phoneFormatting.Replace(strings.TrimSpace(phone))
+	if strings.HasPrefix(normalized, "00") {
+		normalized = "+" + strings.TrimPrefix(normalized, "00")
+	}
+
+	if !e164Pattern.MatchString(normalized) {
+		v.add(field, "%q is not a valid E.164 phone number", phone)
+		return phone
+	}
+
+	return normalized
+}
+
+func (v *validator) metadata(field string, metadata map[string]interface{}) {
+	if len(metadata) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rules := v.metadataRules
+	for _, key := range keys {
+		keyField := fmt.Sprintf("%s[%q]", field, key)
+
+		if rules != nil && len(rules.AllowedKeys) > 0 && !slices.Contains(rules.AllowedKeys, key) {
+			v.add(keyField, "key is not allowed")
+		}
+
+		if _, err := json.Marshal(metadata[key]); err != nil {
+			v.add(keyField, "value cannot be encoded as JSON: %v", err)
+		}
+	}
+
+	if rules != nil && rules.MaxBytes > 0 {
+		if raw, err := json.Marshal(metadata); err == nil && len(raw) > rules.MaxBytes {
+			v.add(field, "must be at most %d bytes when encoded as JSON, got %d", rules.MaxBytes, len(raw))
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package passage
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCreateUserArgsNormalizesPhone(t *testing.T) {
+	tests := map[string]string{
+		"+1 (555) 010-2030": "+15550102030",
+		"0044 20 7946 0000": "+442079460000",
+		"+49.30.1234567":    "+49301234567",
+	}
+
+	for input, expected := range tests {
+		args, err := validateCreateUserArgs(CreateUserArgs{Phone: input}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, expected, args.Phone)
+	}
+}
+
+func TestValidateCreateUserArgsListsEveryProblem(t *testing.T) {
+	_, err := validateCreateUserArgs(CreateUserArgs{
+		Email: "not-an-email",
+		Phone: "555-0102",
+		UserMetadata: map[string]interface{}{
+			"ok":      true,
+			"bad val": make(chan int),
+		},
+	}, nil)
+
+	var validationErr ValidationError
+	require.ErrorAs(t, err, &validationErr)
+
+	fields := []string{}
+	for _, fieldErr := range validationErr.Errors {
+		fields = append(fields, fieldErr.Field)
+	}
+	assert.Equal(t, []string{"Email", "Phone", `UserMetadata["bad val"]`}, fields)
+}
+
+func TestValidateCreateUserArgsRequiresIdentifier(t *testing.T) {
+	_, err := validateCreateUserArgs(CreateUserArgs{}, nil)
+	assert.EqualError(t, err, "At least one of args.Email or args.Phone is required.")
+}
+
+func TestValidateMetadataAllowsAnyKey(t *testing.T) {
+	_, err := validateCreateUserArgs(CreateUserArgs{
+		Email:        "user@example.com",
+		UserMetadata: map[string]interface{}{"first name": "Ada", "app.theme": "dark", strings.Repeat("k", 100): 1},
+	}, nil)
+	assert.NoError(t, err)
+}
+
+func TestValidateMetadataRules(t *testing.T) {
+	rules := &MetadataRules{AllowedKeys: []string{"plan", "bio"}, MaxBytes: 32}
+
+	_, err := validateCreateUserArgs(CreateUserArgs{
+		Email:        "user@example.com",
+		UserMetadata: map[string]interface{}{"plan": "pro"},
+	}, rules)
+	assert.NoError(t, err)
+
+	_, err = validateCreateUserArgs(CreateUserArgs{
+		Email:        "user@example.com",
+		UserMetadata: map[string]interface{}{"bio": strings.Repeat("a", 40), "theme": "dark"},
+	}, rules)
+
+	var validationErr ValidationError
+	require.ErrorAs(t, err, &validationErr)
+
+	fields := []string{}
+	for _, fieldErr := range validationErr.Errors {
+		fields = append(fields, fieldErr.Field)
+	}
+	assert.Equal(t, []string{`UserMetadata["theme"]`, "UserMetadata"}, fields)
+}
+
+func TestWithMetadataRules(t *testing.T) {
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("no request should be sent for invalid metadata")
+	}), WithMetadataRules(MetadataRules{AllowedKeys: []string{"plan"}}))
+
+	_, err := u.Update("user-1", UpdateUserOptions{UserMetadata: map[string]interface{}{"theme": "dark"}})
+	assert.ErrorAs(t, err, &ValidationError{})
+
+	_, err = newConfig([]Option{WithMetadataRules(MetadataRules{MaxBytes: -1})})
+	assert.Error(t, err)
+}
+
+func TestValidateEmail(t *testing.T) {
+	valid := []string{"user@example.com", "first.last+tag@sub.example.co.uk"}
+	invalid := []string{"user", "user@", "@example.com", "User <user@example.com>", "user@localhost", "a b@example.com"}
+
+	for _, email := range valid {
+		var v validator
+		v.email("Email", email)
+		assert.NoError(t, v.err(), email)
+	}
+
+	for _, email := range invalid {
+		var v validator
+		v.email("Email", email)
+		assert.Error(t, v.err(), email)
+	}
+}
+
+func TestCreateValidatesBeforeSending(t *testing.T) {
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("no request should be sent for invalid arguments")
+	}))
+
+	_, err := u.Create(CreateUserArgs{Email: "invalid"})
+	assert.ErrorAs(t, err, &ValidationError{})
+}
+
+func TestCreateSendsNormalizedPhone(t *testing.T) {
+	u := newTestUser(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body CreateUserArgs
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "+15550102030", body.Phone)
+
+		writeJSON(t, w, http.StatusCreated, UserResponse{PassageUser: PassageUser{ID: "user-1", Phone: body.Phone}})
+	}))
+
+	user, err := u.Create(CreateUserArgs{Phone: "+1 555 010 2030"})
+	require.NoError(t, err)
+	assert.Equal(t, "+15550102030", user.Phone)
+}
@@ -0,0 +1,331 @@
+package passage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// WebhookSignatureHeader is the request header carrying the webhook signature.
+	WebhookSignatureHeader = "Passage-Signature"
+
+	defaultWebhookTolerance = 5 * time.Minute
+	maxWebhookBodyBytes     = 1 << 20
+)
+
+// WebhookEventType identifies the kind of a webhook event. The event type names are provisional, like the
+// signature format described on WebhookHandler.
+type WebhookEventType string
+
+const (
+	WebhookUserCreated   WebhookEventType = "user.created"
+	WebhookUserUpdated   WebhookEventType = "user.updated"
+	WebhookUserDeleted   WebhookEventType = "user.deleted"
+	WebhookUserLogin     WebhookEventType = "user.login"
+	WebhookDeviceAdded   WebhookEventType = "user.device.added"
+	WebhookDeviceRemoved WebhookEventType = "user.device.removed"
+)
+
+// WebhookEvent is the envelope shared by every webhook payload.
+type WebhookEvent struct {
+	ID        string           `json:"id"`
+	Type      WebhookEventType `json:"type"`
+	AppID     string           `json:"app_id"`
+	CreatedAt time.Time        `json:"created_at"`
+	Data      json.RawMessage  `json:"data"`
+}
+
+// UserWebhookEvent is delivered for user created, updated and deleted events.
+type UserWebhookEvent struct {
+	WebhookEvent
+	User PassageUser
+}
+
+// LoginWebhookEvent is delivered when a user logs in.
+type LoginWebhookEvent struct {
+	WebhookEvent
+	User  PassageUser
+	Event UserRecentEvent
+}
+
+// DeviceWebhookEvent is delivered when a webauthn device is added to or removed from a user.
+type DeviceWebhookEvent struct {
+	WebhookEvent
+	User   PassageUser
+	Device WebAuthnDevices
+}
+
+// WebhookOptions configures a WebhookHandler.
+type WebhookOptions struct {
+	// Tolerance is the maximum age of a signed request. Defaults to 5 minutes.
+	Tolerance time.Duration
+	// ReplayCache remembers delivered event IDs so replays are rejected. Defaults to an in-memory LRUCache;
+	// use a shared Cache such as RedisCache when webhooks are load balanced across processes.
+	ReplayCache Cache
+}
+
+// WebhookHandler is an http.Handler that receives Passage webhooks.
+//
+// The signature scheme and event type names below are provisional: they are not taken from published Passage API
+// documentation, and may change to match the format Passage delivers.
+//
+// Every request must carry a Passage-Signature header of the form "t=<unix seconds>,v1=<hex signature>", where the
+// signature is the HMAC-SHA256 of "<unix seconds>.<request body>" keyed with the webhook secret. More than one v1
+// entry may be present while secrets are being rotated. Requests with an invalid signature, a timestamp outside
+// the tolerance or an event ID that was already delivered are rejected before any callback runs.
+type WebhookHandler struct {
+	secret      []byte
+	tolerance   time.Duration
+	replayCache Cache
+	now         func() time.Time
+
+	mu        sync.RWMutex
+	callbacks map[WebhookEventType][]func(ctx context.Context, event WebhookEvent) error
+}
+
+// NewWebhookHandler creates a WebhookHandler that verifies requests with secret.
+func NewWebhookHandler(secret string, opts *WebhookOptions) (*WebhookHandler, error) {
+	if secret == "" {
+		return nil, errors.New("secret is required.")
+	}
+
+	h := &WebhookHandler{
+		secret:      []byte(secret),
+		tolerance:   defaultWebhookTolerance,
+		replayCache: NewLRUCache(0),
+		now:         time.Now,
+		callbacks:   map[WebhookEventType][]func(ctx context.Context, event WebhookEvent) error{},
+	}
+
+	if opts != nil {
+		if opts.Tolerance > 0 {
+			h.tolerance = opts.Tolerance
+		}
+		if opts.ReplayCache != nil {
+			h.replayCache = opts.ReplayCache
+		}
+	}
+
+	return h, nil
+}
+
+// OnUserCreated registers fn to be called for user created events.
+func (h *WebhookHandler) OnUserCreated(fn func(ctx context.Context, event UserWebhookEvent) error) {
+	onWebhook(h, WebhookUserCreated, fn, decodeUserWebhookEvent)
+}
+
+// OnUserUpdated registers fn to be called for user updated events.
+func (h *WebhookHandler) OnUserUpdated(fn func(ctx context.Context, event UserWebhookEvent) error) {
+	onWebhook(h, WebhookUserUpdated, fn, decodeUserWebhookEvent)
+}
+
+// OnUserDeleted registers fn to be called for user deleted events.
+func (h *WebhookHandler) OnUserDeleted(fn func(ctx context.Context, event UserWebhookEvent) error) {
+	onWebhook(h, WebhookUserDeleted, fn, decodeUserWebhookEvent)
+}
+
+// OnUserLogin registers fn to be called for user login events.
+func (h *WebhookHandler) OnUserLogin(fn func(ctx context.Context, event LoginWebhookEvent) error) {
+	onWebhook(h, WebhookUserLogin, fn, decodeLoginWebhookEvent)
+}
+
+// OnDeviceAdded registers fn to be called when a device is added to a user.
+func (h *WebhookHandler) OnDeviceAdded(fn func(ctx context.Context, event DeviceWebhookEvent) error) {
+	onWebhook(h, WebhookDeviceAdded, fn, decodeDeviceWebhookEvent)
+}
+
+// OnDeviceRemoved registers fn to be called when a device is removed from a user.
+func (h *WebhookHandler) OnDeviceRemoved(fn func(ctx context.Context, event DeviceWebhookEvent) error) {
+	onWebhook(h, WebhookDeviceRemoved, fn, decodeDeviceWebhookEvent)
+}
+
+func onWebhook[T any](
+	h *WebhookHandler,
+	eventType WebhookEventType,
+	fn func(ctx context.Context, event T) error,
+	decode func(event WebhookEvent) (T, error),
+) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.callbacks[eventType] = append(h.callbacks[eventType], func(ctx context.Context, event WebhookEvent) error {
+		typed, err := decode(event)
+		if err != nil {
+			return err
+		}
+
+		return fn(ctx, typed)
+	})
+}
+
+func decodeUserWebhookEvent(event WebhookEvent) (UserWebhookEvent, error) {
+	var data struct {
+		User PassageUser `json:"user"`
+	}
+	err := decodeWebhookData(event, &data)
+
+	return UserWebhookEvent{WebhookEvent: event, User: data.User}, err
+}
+
+func decodeLoginWebhookEvent(event WebhookEvent) (LoginWebhookEvent, error) {
+	var data struct {
+		User  PassageUser     `json:"user"`
+		Event UserRecentEvent `json:"event"`
+	}
+	err := decodeWebhookData(event, &data)
+
+	return LoginWebhookEvent{WebhookEvent: event, User: data.User, Event: data.Event}, err
+}
+
+func decodeDeviceWebhookEvent(event WebhookEvent) (DeviceWebhookEvent, error) {
+	var data struct {
+		User   PassageUser     `json:"user"`
+		Device WebAuthnDevices `json:"device"`
+	}
+	err := decodeWebhookData(event, &data)
+
+	return DeviceWebhookEvent{WebhookEvent: event, User: data.User, Device: data.Device}, err
+}
+
+func decodeWebhookData(event WebhookEvent, data any) error {
+	if len(event.Data) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(event.Data, data); err != nil {
+		return fmt.Errorf("failed to decode %s webhook event data: %w", event.Type, err)
+	}
+
+	return nil
+}
+
+// ServeHTTP verifies and dispatches a webhook request. It responds with 204 once every callback for the event
+// has succeeded, and with 500 if any callback fails so that the delivery can be retried.
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.verify(r.Header.Get(WebhookSignatureHeader), body); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.ID == "" || event.Type == "" {
+		http.Error(w, "invalid webhook payload", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	replayKey := "passage:webhook:" + event.ID
+
+	// a signature is only accepted within the tolerance either side of its timestamp, so a replay can only
+	// arrive within twice the tolerance of the first delivery
+	added, err := h.replayCache.Add(ctx, replayKey, []byte{1}, 2*h.tolerance)
+	if err != nil {
+		// without a record of the delivery, a replay couldn't be detected
+		http.Error(w, "failed to record webhook event", http.StatusInternalServerError)
+		return
+	}
+
+	if !added {
+		http.Error(w, "webhook event was already delivered", http.StatusConflict)
+		return
+	}
+
+	if err := h.dispatch(ctx, event); err != nil {
+		// forget the event so a retried delivery is processed
+		_ = h.replayCache.Delete(ctx, replayKey)
+		http.Error(w, "failed to handle webhook event", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) dispatch(ctx context.Context, event WebhookEvent) error {
+	h.mu.RLock()
+	callbacks := h.callbacks[event.Type]
+	h.mu.RUnlock()
+
+	for _, callback := range callbacks {
+		if err := callback(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *WebhookHandler) verify(header string, body []byte) error {
+	if header == "" {
+		return errors.New("missing webhook signature")
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return errors.New("malformed webhook signature")
+	}
+
+	age := h.now().Sub(time.Unix(unix, 0))
+	if age > h.tolerance || age < -h.tolerance {
+		return errors.New("webhook timestamp is outside the tolerance")
+	}
+
+	expected := webhookSignature(h.secret, timestamp, body)
+	for _, signature := range signatures {
+		decoded, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+
+	return errors.New("invalid webhook signature")
+}
+
+// SignWebhook returns the Passage-Signature header value for body signed with secret at timestamp.
+// It is useful for testing webhook handlers.
+func SignWebhook(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", unix, hex.EncodeToString(webhookSignature([]byte(secret), unix, body)))
+}
+
+func webhookSignature(secret []byte, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return mac.Sum(nil)
+}
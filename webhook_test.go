@@ -0,0 +1,200 @@
+package passage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testWebhookSecret = "whsec_test"
+
+func newWebhookRequest(t *testing.T, secret string, signedAt time.Time, event any) *http.Request {
+	t.Helper()
+
+	body, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/passage", bytes.NewReader(body))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(secret, signedAt, body))
+	return req
+}
+
+func serveWebhook(h *WebhookHandler, req *http.Request) int {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestWebhookHandlerDispatchesTypedEvents(t *testing.T) {
+	h, err := NewWebhookHandler(testWebhookSecret, nil)
+	require.NoError(t, err)
+
+	var login LoginWebhookEvent
+	h.OnUserLogin(func(_ context.Context, event LoginWebhookEvent) error {
+		login = event
+		return nil
+	})
+
+	var removed DeviceWebhookEvent
+	h.OnDeviceRemoved(func(_ context.Context, event DeviceWebhookEvent) error {
+		removed = event
+		return nil
+	})
+
+	code := serveWebhook(h, newWebhookRequest(t, testWebhookSecret, time.Now(), map[string]any{
+		"id":   "evt-1",
+		"type": WebhookUserLogin,
+		"data": map[string]any{
+			"user":  PassageUser{ID: "user-1"},
+			"event": UserRecentEvent{ID: "event-1", IPAddr: "203.0.113.7", Status: Complete},
+		},
+	}))
+	assert.Equal(t, http.StatusNoContent, code)
+	assert.Equal(t, "evt-1", login.ID)
+	assert.Equal(t, "user-1", login.User.ID)
+	assert.Equal(t, "203.0.113.7", login.Event.IPAddr)
+
+	code = serveWebhook(h, newWebhookRequest(t, testWebhookSecret, time.Now(), map[string]any{
+		"id":   "evt-2",
+		"type": WebhookDeviceRemoved,
+		"data": map[string]any{
+			"user":   PassageUser{ID: "user-1"},
+			"device": WebAuthnDevices{ID: "device-1", Type: SecurityKey},
+		},
+	}))
+	assert.Equal(t, http.StatusNoContent, code)
+	assert.Equal(t, SecurityKey, removed.Device.Type)
+
+	// events without callbacks are acknowledged
+	code = serveWebhook(h, newWebhookRequest(t, testWebhookSecret, time.Now(), map[string]any{
+		"id":   "evt-3",
+		"type": WebhookUserCreated,
+	}))
+	assert.Equal(t, http.StatusNoContent, code)
+}
+
+func TestWebhookHandlerRejectsInvalidRequests(t *testing.T) {
+	h, err := NewWebhookHandler(testWebhookSecret, &WebhookOptions{Tolerance: time.Minute})
+	require.NoError(t, err)
+
+	called := false
+	h.OnUserCreated(func(context.Context, UserWebhookEvent) error {
+		called = true
+		return nil
+	})
+
+	event := map[string]any{"id": "evt-1", "type": WebhookUserCreated}
+
+	assert.Equal(t, http.StatusUnauthorized, serveWebhook(h, newWebhookRequest(t, "wrong-secret", time.Now(), event)))
+	assert.Equal(t, http.StatusUnauthorized, serveWebhook(h, newWebhookRequest(t, testWebhookSecret, time.Now().Add(-2*time.Minute), event)))
+
+	unsigned := newWebhookRequest(t, testWebhookSecret, time.Now(), event)
+	unsigned.Header.Del(WebhookSignatureHeader)
+	assert.Equal(t, http.StatusUnauthorized, serveWebhook(h, unsigned))
+
+	tampered := newWebhookRequest(t, testWebhookSecret, time.Now(), event)
+	tampered.Body = http.NoBody
+	assert.Equal(t, http.StatusUnauthorized, serveWebhook(h, tampered))
+
+	assert.False(t, called)
+}
+
+func TestWebhookHandlerRejectsReplays(t *testing.T) {
+	h, err := NewWebhookHandler(testWebhookSecret, nil)
+	require.NoError(t, err)
+
+	calls := 0
+	h.OnUserDeleted(func(context.Context, UserWebhookEvent) error {
+		calls++
+		return nil
+	})
+
+	event := map[string]any{"id": "evt-1", "type": WebhookUserDeleted}
+	assert.Equal(t, http.StatusNoContent, serveWebhook(h, newWebhookRequest(t, testWebhookSecret, time.Now(), event)))
+	assert.Equal(t, http.StatusConflict, serveWebhook(h, newWebhookRequest(t, testWebhookSecret, time.Now(), event)))
+	assert.Equal(t, 1, calls)
+}
+
+func TestWebhookHandlerAllowsRetryAfterCallbackFailure(t *testing.T) {
+	h, err := NewWebhookHandler(testWebhookSecret, nil)
+	require.NoError(t, err)
+
+	fail := true
+	h.OnUserUpdated(func(context.Context, UserWebhookEvent) error {
+		if fail {
+			return errors.New("database unavailable")
+		}
+		return nil
+	})
+
+	event := map[string]any{"id": "evt-1", "type": WebhookUserUpdated}
+	assert.Equal(t, http.StatusInternalServerError, serveWebhook(h, newWebhookRequest(t, testWebhookSecret, time.Now(), event)))
+
+	fail = false
+	assert.Equal(t, http.StatusNoContent, serveWebhook(h, newWebhookRequest(t, testWebhookSecret, time.Now(), event)))
+}
+
+func TestWebhookHandlerRejectsConcurrentReplays(t *testing.T) {
+	h, err := NewWebhookHandler(testWebhookSecret, &WebhookOptions{ReplayCache: NewRedisCache(newFakeRedis(), "")})
+	require.NoError(t, err)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	h.OnUserDeleted(func(context.Context, UserWebhookEvent) error {
+		calls.Add(1)
+		<-release
+		return nil
+	})
+
+	event := map[string]any{"id": "evt-1", "type": WebhookUserDeleted}
+	statuses := make(chan int, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			statuses <- serveWebhook(h, newWebhookRequest(t, testWebhookSecret, time.Now(), event))
+		}()
+	}
+
+	conflicts := 0
+	for i := 0; i < 4; i++ {
+		if <-statuses == http.StatusConflict {
+			conflicts++
+		}
+	}
+	close(release)
+	assert.Equal(t, http.StatusNoContent, <-statuses)
+	assert.Equal(t, 4, conflicts)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+// failingCache is a Cache whose writes fail.
+type failingCache struct {
+	*LRUCache
+}
+
+func (failingCache) Add(context.Context, string, []byte, time.Duration) (bool, error) {
+	return false, errors.New("cache unavailable")
+}
+
+func TestWebhookHandlerRejectsDeliveryWhenReplayCacheFails(t *testing.T) {
+	h, err := NewWebhookHandler(testWebhookSecret, &WebhookOptions{ReplayCache: failingCache{NewLRUCache(0)}})
+	require.NoError(t, err)
+
+	called := false
+	h.OnUserDeleted(func(context.Context, UserWebhookEvent) error {
+		called = true
+		return nil
+	})
+
+	event := map[string]any{"id": "evt-1", "type": WebhookUserDeleted}
+	assert.Equal(t, http.StatusInternalServerError, serveWebhook(h, newWebhookRequest(t, testWebhookSecret, time.Now(), event)))
+	assert.False(t, called)
+}